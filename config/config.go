@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,6 +16,66 @@ func LogLevel() string {
 	return viper.GetString("log_level")
 }
 
+// AssumeYes answers yes to the confirmation prompt of every command, so that they can run unattended
+func AssumeYes() bool {
+	return viper.GetBool("assume_yes")
+}
+
+// ShowSecrets prints API keys and other secrets in full in the confirmation prompts and logs instead of masking them
+func ShowSecrets() bool {
+	return viper.GetBool("show_secrets")
+}
+
+// typesenseSections are the config sections holding the connection to a Typesense server
+var typesenseSections = []string{
+	"migration.source",
+	"migration.destination",
+	"backup",
+	"restore",
+	"snapshot",
+	"restore_snapshot",
+	"reindex",
+	"verify.source",
+	"verify.destination",
+	"delete_collection",
+}
+
+// SecretKeys returns the keys of the settings holding a secret: the API key of every Typesense connection and cluster,
+// the S3 credentials and the Vault token
+func SecretKeys() []string {
+	var keys []string
+	for _, section := range typesenseSections {
+		keys = append(keys, section+".typesense.api_key")
+	}
+	for cluster := range viper.GetStringMap("clusters") {
+		keys = append(keys, "clusters."+cluster+".api_key")
+	}
+
+	return append(keys, "storage.s3.access_key_id", "storage.s3.secret_access_key", "secrets.vault.token")
+}
+
+// Secrets returns the values of the settings of SecretKeys, which are masked in the logs, together with the secrets
+// actually used once resolved by their getters, such as the Vault token read from VAULT_TOKEN or the API key given by
+// a flag on top of a cluster
+func Secrets() []string {
+	candidates := []string{SecretsVaultToken(), StorageS3AccessKeyID(), StorageS3SecretAccessKey()}
+	for _, section := range typesenseSections {
+		candidates = append(candidates, typesenseConnection(section).APIKey)
+	}
+	for _, key := range SecretKeys() {
+		candidates = append(candidates, viper.GetString(key))
+	}
+
+	var secrets []string
+	for _, secret := range candidates {
+		if secret != "" && !slices.Contains(secrets, secret) {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets
+}
+
 // HTTPTLSHandshakeTimeout set a limit on how long the application waits for a TLS handshake to complete when establishing a connection
 func HTTPTLSHandshakeTimeout() time.Duration {
 	return utils.ValueOrDefault[time.Duration](viper.GetDuration("http_connection_settings.tls_handshake_timeout"), DefaultHTTPTLSHandshakeTimeout)
@@ -24,24 +86,103 @@ func HTTPTimeout() time.Duration {
 	return utils.ValueOrDefault[time.Duration](viper.GetDuration("http_connection_settings.timeout"), DefaultHTTPTimeout)
 }
 
+// ClusterDefined reports whether a cluster of the given name is described in the clusters settings
+func ClusterDefined(name string) bool {
+	return viper.IsSet("clusters." + name)
+}
+
+// flagKeys holds the keys of the settings given by command line flags
+var flagKeys = make(map[string]bool)
+
+// SetByFlag records that a setting is given by a command line flag
+func SetByFlag(key string) {
+	flagKeys[key] = true
+}
+
+// IsSetByFlag reports whether a setting is given by a command line flag rather than the config file or the environment
+func IsSetByFlag(key string) bool {
+	return flagKeys[key]
+}
+
+// ResetFlags forgets the settings given by command line flags, like viper.Reset for the other settings
+func ResetFlags() {
+	flagKeys = make(map[string]bool)
+}
+
+// typesenseKey returns the key of a typesense setting of a config section, read from the cluster the section names
+// when it has one, otherwise from its own typesense settings. A typesense setting of the section given by a flag
+// overrides the cluster.
+func typesenseKey(section, name string) string {
+	key := section + ".typesense." + name
+	if cluster := viper.GetString(section + ".cluster"); cluster != "" && !IsSetByFlag(key) {
+		return "clusters." + cluster + "." + name
+	}
+
+	return key
+}
+
+// typesenseConnection returns the connection settings of a config section, the timeouts of a cluster default to the
+// http_connection_settings
+func typesenseConnection(section string) TypesenseConnection {
+	connection := TypesenseConnection{
+		Host:                viper.GetString(typesenseKey(section, "host")),
+		APIKey:              viper.GetString(typesenseKey(section, "api_key")),
+		Timeout:             HTTPTimeout(),
+		TLSHandshakeTimeout: HTTPTLSHandshakeTimeout(),
+		TLS: TLSSettings{
+			InsecureSkipVerify: viper.GetBool(typesenseKey(section, "tls.insecure_skip_verify")),
+			CAFile:             viper.GetString(typesenseKey(section, "tls.ca_file")),
+			CertFile:           viper.GetString(typesenseKey(section, "tls.cert_file")),
+			KeyFile:            viper.GetString(typesenseKey(section, "tls.key_file")),
+			ServerName:         viper.GetString(typesenseKey(section, "tls.server_name")),
+		},
+	}
+	if cluster := viper.GetString(section + ".cluster"); cluster != "" {
+		connection.Timeout = utils.ValueOrDefault[time.Duration](viper.GetDuration("clusters."+cluster+".timeout"), connection.Timeout)
+		connection.TLSHandshakeTimeout = utils.ValueOrDefault[time.Duration](viper.GetDuration("clusters."+cluster+".tls_handshake_timeout"), connection.TLSHandshakeTimeout)
+	}
+
+	return connection
+}
+
 // MigrationSourceTypesenseHost used to specify the hostname or IP address of the Typesense instance from which migration data is sourced
 func MigrationSourceTypesenseHost() string {
-	return viper.GetString("migration.source.typesense.host")
+	return viper.GetString(typesenseKey("migration.source", "host"))
 }
 
 // MigrationSourceTypesenseAPIKey used to authenticate requests to the Typesense instance from which migration data is sourced
 func MigrationSourceTypesenseAPIKey() string {
-	return viper.GetString("migration.source.typesense.api_key")
+	return viper.GetString(typesenseKey("migration.source", "api_key"))
+}
+
+// MigrationSourceCluster names the cluster of the clusters settings used as the Typesense instance from which migration data is sourced, instead of migration.source.typesense
+func MigrationSourceCluster() string {
+	return viper.GetString("migration.source.cluster")
+}
+
+// MigrationSourceTypesenseConnection returns the connection settings of the Typesense instance from which migration data is sourced
+func MigrationSourceTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("migration.source")
 }
 
 // MigrationDestinationTypesenseHost used to specify the hostname or IP address of the Typesense instance to which migration data will be written
 func MigrationDestinationTypesenseHost() string {
-	return viper.GetString("migration.destination.typesense.host")
+	return viper.GetString(typesenseKey("migration.destination", "host"))
 }
 
 // MigrationDestinationTypesenseAPIKey used to authenticate requests to the Typesense instance to which migration data will be written
 func MigrationDestinationTypesenseAPIKey() string {
-	return viper.GetString("migration.destination.typesense.api_key")
+	return viper.GetString(typesenseKey("migration.destination", "api_key"))
+}
+
+// MigrationDestinationCluster names the cluster of the clusters settings used as the Typesense instance to which migration data will be written, instead of migration.destination.typesense
+func MigrationDestinationCluster() string {
+	return viper.GetString("migration.destination.cluster")
+}
+
+// MigrationDestinationTypesenseConnection returns the connection settings of the Typesense instance to which migration data will be written
+func MigrationDestinationTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("migration.destination")
 }
 
 // MigrationBatchSize defines the maximum number of documents to process in a Typesense search batch
@@ -54,6 +195,11 @@ func MigrationSleepInterval() time.Duration {
 	return utils.ValueOrDefault[time.Duration](viper.GetDuration("migration.sleep_interval"), DefaultMigrationSleepInterval)
 }
 
+// MigrationWorkers defines the number of batches transformed and imported concurrently, each worker waits for the sleep interval after its imports
+func MigrationWorkers() int {
+	return utils.ValueOrDefault[int](viper.GetInt("migration.workers"), DefaultMigrationWorkers)
+}
+
 // MigrationSourceCollection specifies the collection in the source Typesense instance from which data will be migrated
 func MigrationSourceCollection() string {
 	return viper.GetString("migration.source.collection")
@@ -79,19 +225,124 @@ func MigrationSorter() string {
 	return viper.GetString("migration.sorter")
 }
 
+// MigrationCursorField specifies a numeric field to page through the source collection with a cursor instead of page numbers, replacing the sorter (optional)
+func MigrationCursorField() string {
+	return viper.GetString("migration.cursor_field")
+}
+
 // MigrationFilter specifies a condition or query to filter which documents from the source collection should be migrated to the destination collection
 func MigrationFilter() string {
 	return viper.GetString("migration.filter")
 }
 
+// MigrationRejectedFilePath specifies the dead-letter file where documents rejected by the destination collection are written
+func MigrationRejectedFilePath() string {
+	return utils.ValueOrDefault[string](viper.GetString("migration.rejected_file_path"), DefaultMigrationRejectedFilePath)
+}
+
+// MigrationMaxFailureRatio defines the ratio of rejected documents (0 to 1) above which the migration is stopped
+func MigrationMaxFailureRatio() float64 {
+	return viper.GetFloat64("migration.max_failure_ratio")
+}
+
+// MigrationTransforms lists the rules applied in order to every document before it is imported into the destination collection
+func MigrationTransforms() []Transform {
+	var transforms []Transform
+	if err := viper.UnmarshalKey("migration.transforms", &transforms); err != nil {
+		log.Warnf("invalid migration.transforms: %v", err)
+	}
+
+	return transforms
+}
+
+// MigrationTransformScript specifies a JavaScript file defining a transform(doc) function run on every document after migration.transforms (optional)
+func MigrationTransformScript() string {
+	return viper.GetString("migration.transform_script")
+}
+
+// MigrationDestinationCreateCollection makes migrate create the destination collection from the source collection schema when it does not exist
+func MigrationDestinationCreateCollection() bool {
+	return viper.GetBool("migration.destination.create_collection")
+}
+
+// MigrationDestinationSchemaAddFields lists the field definitions appended to the source schema when creating the destination collection
+func MigrationDestinationSchemaAddFields() []map[string]any {
+	var fields []map[string]any
+	if err := viper.UnmarshalKey("migration.destination.schema.add_fields", &fields); err != nil {
+		log.Warnf("invalid migration.destination.schema.add_fields: %v", err)
+	}
+
+	return fields
+}
+
+// MigrationDestinationSchemaDropFields lists the fields of the source schema left out when creating the destination collection
+func MigrationDestinationSchemaDropFields() []string {
+	return viper.GetStringSlice("migration.destination.schema.drop_fields")
+}
+
+// MigrationDestinationSchemaRetypeFields lists the fields of the source schema whose type is changed when creating the destination collection
+func MigrationDestinationSchemaRetypeFields() []FieldType {
+	var fields []FieldType
+	if err := viper.UnmarshalKey("migration.destination.schema.retype_fields", &fields); err != nil {
+		log.Warnf("invalid migration.destination.schema.retype_fields: %v", err)
+	}
+
+	return fields
+}
+
+// MigrationDestinationSchemaDefaultSortingField replaces the default_sorting_field of the source schema when creating the destination collection
+func MigrationDestinationSchemaDefaultSortingField() string {
+	return viper.GetString("migration.destination.schema.default_sorting_field")
+}
+
+// MigrationSyncTimestampField specifies the numeric field, such as updated_at, whose value grows every time a document is written, used by sync to find the changed documents
+func MigrationSyncTimestampField() string {
+	return viper.GetString("migration.sync.timestamp_field")
+}
+
+// MigrationSyncPollInterval defines the duration sync waits between two polls of the source collection
+func MigrationSyncPollInterval() time.Duration {
+	return utils.ValueOrDefault[time.Duration](viper.GetDuration("migration.sync.poll_interval"), DefaultMigrationSyncPollInterval)
+}
+
+// MigrationSyncStateFilePath specifies the file where sync persists the timestamp watermark between polls and runs
+func MigrationSyncStateFilePath() string {
+	return utils.ValueOrDefault[string](viper.GetString("migration.sync.state_file_path"), DefaultMigrationSyncStateFilePath)
+}
+
+// MigrationSyncReconcileInterval defines how often sync deletes the destination documents missing from the source, zero disables it
+func MigrationSyncReconcileInterval() time.Duration {
+	return viper.GetDuration("migration.sync.reconcile.interval")
+}
+
+// MigrationSyncReconcileDryRun makes the reconciliation list the destination documents it would delete without deleting them
+func MigrationSyncReconcileDryRun() bool {
+	return viper.GetBool("migration.sync.reconcile.dry_run")
+}
+
+// MigrationSyncReconcileMaxDeletions defines the number of documents above which a reconciliation stops the sync instead of deleting them
+func MigrationSyncReconcileMaxDeletions() int {
+	return utils.ValueOrDefault[int](viper.GetInt("migration.sync.reconcile.max_deletions"), DefaultMigrationSyncReconcileMaxDeletions)
+}
+
 // BackupTypesenseHost specifies the hostname or IP address of the Typesense server where backup operations are performed
 func BackupTypesenseHost() string {
-	return viper.GetString("backup.typesense.host")
+	return viper.GetString(typesenseKey("backup", "host"))
 }
 
 // BackupTypesenseAPIKey used to authenticate requests to the Typesense instance during backup operations
 func BackupTypesenseAPIKey() string {
-	return viper.GetString("backup.typesense.api_key")
+	return viper.GetString(typesenseKey("backup", "api_key"))
+}
+
+// BackupCluster names the cluster of the clusters settings used as the Typesense server where backup operations are performed, instead of backup.typesense
+func BackupCluster() string {
+	return viper.GetString("backup.cluster")
+}
+
+// BackupTypesenseConnection returns the connection settings of the Typesense server where backup operations are performed
+func BackupTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("backup")
 }
 
 // BackupCollection specifies the collection in the Typesense instance from which data will be backed up
@@ -139,14 +390,44 @@ func BackupSorter() string {
 	return viper.GetString("backup.sorter")
 }
 
+// BackupCursorField specifies a numeric field to page through the collection with a cursor instead of page numbers, replacing the sorter (optional)
+func BackupCursorField() string {
+	return viper.GetString("backup.cursor_field")
+}
+
+// BackupMode specifies how documents are read from the collection during backup, either paginated "search" or streamed "export"
+func BackupMode() string {
+	return utils.ValueOrDefault[string](viper.GetString("backup.mode"), DefaultBackupMode)
+}
+
+// BackupCompression specifies how backup files are compressed, either "none", "gzip" or "zstd"
+func BackupCompression() string {
+	return utils.ValueOrDefault[string](viper.GetString("backup.compression"), DefaultBackupCompression)
+}
+
+// BackupExportTimeout defines the maximum duration of a streamed export request before timing out, zero means no timeout
+func BackupExportTimeout() time.Duration {
+	return viper.GetDuration("backup.export_timeout")
+}
+
 // RestoreTypesenseHost specifies the hostname or IP address of the Typesense server where restore operations will be performed
 func RestoreTypesenseHost() string {
-	return viper.GetString("restore.typesense.host")
+	return viper.GetString(typesenseKey("restore", "host"))
 }
 
 // RestoreTypesenseAPIKey used to authenticate requests to the Typesense instance during restore operations
 func RestoreTypesenseAPIKey() string {
-	return viper.GetString("restore.typesense.api_key")
+	return viper.GetString(typesenseKey("restore", "api_key"))
+}
+
+// RestoreCluster names the cluster of the clusters settings used as the Typesense server where restore operations will be performed, instead of restore.typesense
+func RestoreCluster() string {
+	return viper.GetString("restore.cluster")
+}
+
+// RestoreTypesenseConnection returns the connection settings of the Typesense server where restore operations will be performed
+func RestoreTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("restore")
 }
 
 // RestoreCollection specifies the collection in the Typesense instance where data will be restored
@@ -169,14 +450,378 @@ func RestoreSleepInterval() time.Duration {
 	return utils.ValueOrDefault[time.Duration](viper.GetDuration("restore.sleep_interval"), DefaultRestoreSleepInterval)
 }
 
+// RestoreFiles lists the backup files to restore in that order, instead of every file of the folder (optional)
+func RestoreFiles() []string {
+	return viper.GetStringSlice("restore.files")
+}
+
+// RestoreInclude lists glob patterns limiting the restore to the backup files matching one of them (optional)
+func RestoreInclude() []string {
+	return viper.GetStringSlice("restore.include")
+}
+
+// RestoreExclude lists glob patterns of backup files left out of the restore (optional)
+func RestoreExclude() []string {
+	return viper.GetStringSlice("restore.exclude")
+}
+
+// RestoreMaxLineSize defines the longest line accepted in a backup file, in bytes or as a size such as "64MB"
+func RestoreMaxLineSize() int {
+	return utils.ValueOrDefault[int](int(viper.GetSizeInBytes("restore.max_line_size")), DefaultRestoreMaxLineSize)
+}
+
+// RestoreWorkers defines the number of batches transformed and imported concurrently, each worker waits for the sleep interval after its imports
+func RestoreWorkers() int {
+	return utils.ValueOrDefault[int](viper.GetInt("restore.workers"), DefaultRestoreWorkers)
+}
+
+// RestoreTransformScript specifies a JavaScript file defining a transform(doc) function run on every document before it is imported (optional)
+func RestoreTransformScript() string {
+	return viper.GetString("restore.transform_script")
+}
+
+// RestoreIgnoreChecksumMismatch makes restore proceed with a warning when the backup files do not match the manifest, instead of refusing to import
+func RestoreIgnoreChecksumMismatch() bool {
+	return viper.GetBool("restore.ignore_checksum_mismatch")
+}
+
+// RestoreRejectedFilePath specifies the dead-letter file where documents rejected by the collection are written
+func RestoreRejectedFilePath() string {
+	return utils.ValueOrDefault[string](viper.GetString("restore.rejected_file_path"), DefaultRestoreRejectedFilePath)
+}
+
+// RestoreMaxFailureRatio defines the ratio of rejected documents (0 to 1) above which the restore is stopped
+func RestoreMaxFailureRatio() float64 {
+	return viper.GetFloat64("restore.max_failure_ratio")
+}
+
+// SnapshotTypesenseHost specifies the hostname or IP address of the Typesense server of which a full snapshot is taken
+func SnapshotTypesenseHost() string {
+	return viper.GetString(typesenseKey("snapshot", "host"))
+}
+
+// SnapshotTypesenseAPIKey used to authenticate requests to the Typesense instance during snapshot operations, it needs access to every resource
+func SnapshotTypesenseAPIKey() string {
+	return viper.GetString(typesenseKey("snapshot", "api_key"))
+}
+
+// SnapshotCluster names the cluster of the clusters settings used as the Typesense server of which a full snapshot is taken, instead of snapshot.typesense
+func SnapshotCluster() string {
+	return viper.GetString("snapshot.cluster")
+}
+
+// SnapshotTypesenseConnection returns the connection settings of the Typesense server of which a full snapshot is taken
+func SnapshotTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("snapshot")
+}
+
+// SnapshotFolderPath specifies where the snapshot is saved, either a local folder or a s3:// URL
+func SnapshotFolderPath() string {
+	return viper.GetString("snapshot.folder_path")
+}
+
+// SnapshotCollections limits the snapshot to the given collections and the aliases pointing to them (optional, every collection by default)
+func SnapshotCollections() []string {
+	return viper.GetStringSlice("snapshot.collections")
+}
+
+// SnapshotIncludeAPIKeys adds the metadata of the API keys to the snapshot, the key values can not be exported
+func SnapshotIncludeAPIKeys() bool {
+	return viper.GetBool("snapshot.include_api_keys")
+}
+
+// SnapshotCompression defines the compression of the document files: none, gzip or zstd
+func SnapshotCompression() string {
+	return utils.ValueOrDefault[string](viper.GetString("snapshot.compression"), DefaultSnapshotCompression)
+}
+
+// SnapshotMaxDocsPerFile defines how many documents will be stored in each document file before creating a new one
+func SnapshotMaxDocsPerFile() int {
+	return utils.ValueOrDefault[int](viper.GetInt("snapshot.max_docs_per_file"), DefaultSnapshotMaxDocsPerFile)
+}
+
+// SnapshotExportTimeout defines the maximum duration of the export request of each collection, zero means no timeout
+func SnapshotExportTimeout() time.Duration {
+	return viper.GetDuration("snapshot.export_timeout")
+}
+
+// RestoreSnapshotTypesenseHost specifies the hostname or IP address of the Typesense server where a snapshot is restored
+func RestoreSnapshotTypesenseHost() string {
+	return viper.GetString(typesenseKey("restore_snapshot", "host"))
+}
+
+// RestoreSnapshotTypesenseAPIKey used to authenticate requests to the Typesense instance during snapshot restoration
+func RestoreSnapshotTypesenseAPIKey() string {
+	return viper.GetString(typesenseKey("restore_snapshot", "api_key"))
+}
+
+// RestoreSnapshotCluster names the cluster of the clusters settings used as the Typesense server where a snapshot is restored, instead of restore_snapshot.typesense
+func RestoreSnapshotCluster() string {
+	return viper.GetString("restore_snapshot.cluster")
+}
+
+// RestoreSnapshotTypesenseConnection returns the connection settings of the Typesense server where a snapshot is restored
+func RestoreSnapshotTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("restore_snapshot")
+}
+
+// RestoreSnapshotFolderPath specifies where the snapshot to restore is read from, either a local folder or a s3:// URL
+func RestoreSnapshotFolderPath() string {
+	return viper.GetString("restore_snapshot.folder_path")
+}
+
+// RestoreSnapshotCollections limits the restoration to the given collections of the snapshot (optional, every collection by default)
+func RestoreSnapshotCollections() []string {
+	return viper.GetStringSlice("restore_snapshot.collections")
+}
+
+// RestoreSnapshotBatchSize defines the number of documents to be processed in each import batch
+func RestoreSnapshotBatchSize() int {
+	return utils.ValueOrDefault[int](viper.GetInt("restore_snapshot.batch_size"), DefaultRestoreSnapshotBatchSize)
+}
+
+// RestoreSnapshotSleepInterval defines the duration the application waits between consecutive import batches
+func RestoreSnapshotSleepInterval() time.Duration {
+	return utils.ValueOrDefault[time.Duration](viper.GetDuration("restore_snapshot.sleep_interval"), DefaultRestoreSnapshotSleepInterval)
+}
+
+// RestoreSnapshotMaxLineSize defines the longest line accepted in a document file, in bytes or as a size such as "64MB"
+func RestoreSnapshotMaxLineSize() int {
+	return utils.ValueOrDefault[int](int(viper.GetSizeInBytes("restore_snapshot.max_line_size")), DefaultRestoreSnapshotMaxLineSize)
+}
+
+// RestoreSnapshotRejectedFilePath specifies the dead-letter file where documents rejected by the collections are written
+func RestoreSnapshotRejectedFilePath() string {
+	return utils.ValueOrDefault[string](viper.GetString("restore_snapshot.rejected_file_path"), DefaultRestoreSnapshotRejectedFilePath)
+}
+
+// RestoreSnapshotMaxFailureRatio defines the ratio of rejected documents (0 to 1) above which the restoration is stopped
+func RestoreSnapshotMaxFailureRatio() float64 {
+	return viper.GetFloat64("restore_snapshot.max_failure_ratio")
+}
+
+// ReindexTypesenseHost specifies the hostname or IP address of the Typesense server where the alias is reindexed
+func ReindexTypesenseHost() string {
+	return viper.GetString(typesenseKey("reindex", "host"))
+}
+
+// ReindexTypesenseAPIKey used to authenticate requests to the Typesense instance during reindex operations
+func ReindexTypesenseAPIKey() string {
+	return viper.GetString(typesenseKey("reindex", "api_key"))
+}
+
+// ReindexCluster names the cluster of the clusters settings used as the Typesense server where the alias is reindexed, instead of reindex.typesense
+func ReindexCluster() string {
+	return viper.GetString("reindex.cluster")
+}
+
+// ReindexTypesenseConnection returns the connection settings of the Typesense server where the alias is reindexed
+func ReindexTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("reindex")
+}
+
+// ReindexAlias specifies the live alias whose collection is rebuilt and swapped
+func ReindexAlias() string {
+	return viper.GetString("reindex.alias")
+}
+
+// ReindexCollection specifies the name of the new collection (optional, the next _vN version of the current collection by default)
+func ReindexCollection() string {
+	return viper.GetString("reindex.collection")
+}
+
+// ReindexSchemaFile specifies a JSON file holding the schema of the new collection (optional, the current schema is copied by default)
+func ReindexSchemaFile() string {
+	return viper.GetString("reindex.schema_file")
+}
+
+// ReindexBatchSize defines the number of documents to be processed in each migration and deletion batch
+func ReindexBatchSize() int {
+	return utils.ValueOrDefault[int](viper.GetInt("reindex.batch_size"), DefaultReindexBatchSize)
+}
+
+// ReindexSleepInterval defines the duration the application waits between consecutive migration and deletion batches
+func ReindexSleepInterval() time.Duration {
+	return utils.ValueOrDefault[time.Duration](viper.GetDuration("reindex.sleep_interval"), DefaultReindexSleepInterval)
+}
+
+// ReindexWorkers defines the number of batches transformed and imported concurrently into the new collection
+func ReindexWorkers() int {
+	return utils.ValueOrDefault[int](viper.GetInt("reindex.workers"), DefaultReindexWorkers)
+}
+
+// ReindexSorter specifies the field or criteria by which the documents are sorted while paging through the current collection (optional)
+func ReindexSorter() string {
+	return viper.GetString("reindex.sorter")
+}
+
+// ReindexCursorField specifies a numeric field updated on every write, such as updated_at, to page through the current collection with a cursor and catch up on the documents written while copying (optional)
+func ReindexCursorField() string {
+	return viper.GetString("reindex.cursor_field")
+}
+
+// ReindexTransforms lists the rules applied in order to every document before it is imported into the new collection
+func ReindexTransforms() []Transform {
+	var transforms []Transform
+	if err := viper.UnmarshalKey("reindex.transforms", &transforms); err != nil {
+		log.Warnf("invalid reindex.transforms: %v", err)
+	}
+
+	return transforms
+}
+
+// ReindexTransformScript specifies a JavaScript file defining a transform(doc) function run on every document after reindex.transforms (optional)
+func ReindexTransformScript() string {
+	return viper.GetString("reindex.transform_script")
+}
+
+// ReindexRejectedFilePath specifies the dead-letter file where documents rejected by the new collection are written
+func ReindexRejectedFilePath() string {
+	return utils.ValueOrDefault[string](viper.GetString("reindex.rejected_file_path"), DefaultReindexRejectedFilePath)
+}
+
+// ReindexMaxFailureRatio defines the ratio of rejected documents (0 to 1) above which the reindex is stopped
+func ReindexMaxFailureRatio() float64 {
+	return viper.GetFloat64("reindex.max_failure_ratio")
+}
+
+// ReindexAllowCountMismatch lets the alias be swapped even though the new collection does not hold as many documents as the current one
+func ReindexAllowCountMismatch() bool {
+	return viper.GetBool("reindex.allow_count_mismatch")
+}
+
+// ReindexDeleteOldCollection makes reindex delete the previous collection gracefully once the alias points to the new one
+func ReindexDeleteOldCollection() bool {
+	return viper.GetBool("reindex.delete_old_collection")
+}
+
+// VerifySourceTypesenseHost specifies the hostname or IP address of the Typesense server holding the expected documents
+func VerifySourceTypesenseHost() string {
+	return viper.GetString(typesenseKey("verify.source", "host"))
+}
+
+// VerifySourceTypesenseAPIKey used to authenticate requests to the Typesense instance holding the expected documents
+func VerifySourceTypesenseAPIKey() string {
+	return viper.GetString(typesenseKey("verify.source", "api_key"))
+}
+
+// VerifySourceCluster names the cluster of the clusters settings used as the Typesense server holding the expected documents, instead of verify.source.typesense
+func VerifySourceCluster() string {
+	return viper.GetString("verify.source.cluster")
+}
+
+// VerifySourceTypesenseConnection returns the connection settings of the Typesense server holding the expected documents
+func VerifySourceTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("verify.source")
+}
+
+// VerifySourceCollection specifies the collection holding the expected documents, exclusive with verify.source.folder_path
+func VerifySourceCollection() string {
+	return viper.GetString("verify.source.collection")
+}
+
+// VerifySourceFolderPath specifies a backup folder holding the expected documents, either a local folder or a s3:// URL
+func VerifySourceFolderPath() string {
+	return viper.GetString("verify.source.folder_path")
+}
+
+// VerifyDestinationTypesenseHost specifies the hostname or IP address of the Typesense server holding the verified collection
+func VerifyDestinationTypesenseHost() string {
+	return viper.GetString(typesenseKey("verify.destination", "host"))
+}
+
+// VerifyDestinationTypesenseAPIKey used to authenticate requests to the Typesense instance holding the verified collection
+func VerifyDestinationTypesenseAPIKey() string {
+	return viper.GetString(typesenseKey("verify.destination", "api_key"))
+}
+
+// VerifyDestinationCluster names the cluster of the clusters settings used as the Typesense server holding the verified collection, instead of verify.destination.typesense
+func VerifyDestinationCluster() string {
+	return viper.GetString("verify.destination.cluster")
+}
+
+// VerifyDestinationTypesenseConnection returns the connection settings of the Typesense server holding the verified collection
+func VerifyDestinationTypesenseConnection() TypesenseConnection {
+	return typesenseConnection("verify.destination")
+}
+
+// VerifyDestinationCollection specifies the collection compared with the expected documents
+func VerifyDestinationCollection() string {
+	return viper.GetString("verify.destination.collection")
+}
+
+// VerifyFilter specifies the filter applied to the source collection, e.g. the one used by the migration (optional)
+func VerifyFilter() string {
+	return viper.GetString("verify.filter")
+}
+
+// VerifyIncludedFields limits the comparison to the given fields, id being always compared (optional)
+func VerifyIncludedFields() []string {
+	return viper.GetStringSlice("verify.included_fields")
+}
+
+// VerifyExcludedFields leaves the given fields out of the comparison (optional)
+func VerifyExcludedFields() []string {
+	return viper.GetStringSlice("verify.excluded_fields")
+}
+
+// VerifyTransforms lists the rules applied in order to every source document to get the expected document
+func VerifyTransforms() []Transform {
+	var transforms []Transform
+	if err := viper.UnmarshalKey("verify.transforms", &transforms); err != nil {
+		log.Warnf("invalid verify.transforms: %v", err)
+	}
+
+	return transforms
+}
+
+// VerifyTransformScript specifies a JavaScript file defining a transform(doc) function run on every source document after verify.transforms (optional)
+func VerifyTransformScript() string {
+	return viper.GetString("verify.transform_script")
+}
+
+// VerifyExportTimeout defines the maximum duration of each export request, zero means no timeout
+func VerifyExportTimeout() time.Duration {
+	return viper.GetDuration("verify.export_timeout")
+}
+
+// VerifyReportFilePath specifies the file where the missing, extra and differing documents are reported
+func VerifyReportFilePath() string {
+	return utils.ValueOrDefault[string](viper.GetString("verify.report_file_path"), DefaultVerifyReportFilePath)
+}
+
+// VerifyMaxFieldDiffs defines for how many differing documents the differing fields are reported, the ids of the others are reported alone, 0 reports ids only
+func VerifyMaxFieldDiffs() int {
+	if !viper.IsSet("verify.max_field_diffs") {
+		return DefaultVerifyMaxFieldDiffs
+	}
+
+	return viper.GetInt("verify.max_field_diffs")
+}
+
+// VerifySortBatchSize defines the number of documents sorted in memory at once, larger collections are sorted through temporary files
+func VerifySortBatchSize() int {
+	return utils.ValueOrDefault[int](viper.GetInt("verify.sort_batch_size"), DefaultVerifySortBatchSize)
+}
+
 // TypesenseHostForCollectionDeletion specifies the hostname or IP address of the Typesense server where the collection deletion operation will be performed
 func TypesenseHostForCollectionDeletion() string {
-	return viper.GetString("delete_collection.typesense.host")
+	return viper.GetString(typesenseKey("delete_collection", "host"))
 }
 
 // TypesenseAPIKeyForCollectionDeletion used to authenticate requests to the Typesense instance during the collection deletion process
 func TypesenseAPIKeyForCollectionDeletion() string {
-	return viper.GetString("delete_collection.typesense.api_key")
+	return viper.GetString(typesenseKey("delete_collection", "api_key"))
+}
+
+// ClusterForCollectionDeletion names the cluster of the clusters settings used as the Typesense server where the collection deletion operation will be performed, instead of delete_collection.typesense
+func ClusterForCollectionDeletion() string {
+	return viper.GetString("delete_collection.cluster")
+}
+
+// TypesenseConnectionForCollectionDeletion returns the connection settings of the Typesense server where the collection deletion operation will be performed
+func TypesenseConnectionForCollectionDeletion() TypesenseConnection {
+	return typesenseConnection("delete_collection")
 }
 
 // CollectionNameToDelete specifies the name of the collection that will be deleted
@@ -204,12 +849,64 @@ func ExcludedFieldsForCollectionDeletion() []string {
 	return viper.GetStringSlice("delete_collection.excluded_fields")
 }
 
-// GetConf read the configuration file
-func GetConf() {
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./..")
-	viper.AddConfigPath("./../..")
-	viper.SetConfigName("config")
+// StorageS3Endpoint specifies the host of the S3-compatible service used by s3:// folder paths
+func StorageS3Endpoint() string {
+	return utils.ValueOrDefault[string](viper.GetString("storage.s3.endpoint"), DefaultStorageS3Endpoint)
+}
+
+// StorageS3Region specifies the region of the bucket, it is detected from the bucket location when empty
+func StorageS3Region() string {
+	return viper.GetString("storage.s3.region")
+}
+
+// StorageS3AccessKeyID used with StorageS3SecretAccessKey to authenticate to the S3-compatible service,
+// credentials are read from the AWS environment variables, credentials file or instance role when empty
+func StorageS3AccessKeyID() string {
+	return viper.GetString("storage.s3.access_key_id")
+}
+
+// StorageS3SecretAccessKey used with StorageS3AccessKeyID to authenticate to the S3-compatible service
+func StorageS3SecretAccessKey() string {
+	return viper.GetString("storage.s3.secret_access_key")
+}
+
+// StorageS3DisableSSL makes the S3-compatible service be reached over plain HTTP
+func StorageS3DisableSSL() bool {
+	return viper.GetBool("storage.s3.disable_ssl")
+}
+
+// StorageS3ForcePathStyle makes buckets be addressed as endpoint/bucket instead of bucket.endpoint, which most self-hosted services need
+func StorageS3ForcePathStyle() bool {
+	return viper.GetBool("storage.s3.force_path_style")
+}
+
+// SecretsVaultAddress is the address of the Vault server resolving the vault: references of secret settings,
+// VAULT_ADDR is used when empty
+func SecretsVaultAddress() string {
+	return utils.ValueOrDefault[string](viper.GetString("secrets.vault.address"), os.Getenv("VAULT_ADDR"))
+}
+
+// SecretsVaultToken used to authenticate to the Vault server, VAULT_TOKEN is used when empty
+func SecretsVaultToken() string {
+	return utils.ValueOrDefault[string](viper.GetString("secrets.vault.token"), os.Getenv("VAULT_TOKEN"))
+}
+
+// SecretsVaultNamespace is the Vault Enterprise namespace the secrets are read from
+func SecretsVaultNamespace() string {
+	return viper.GetString("secrets.vault.namespace")
+}
+
+// GetConf read the configuration file, configFile replaces the search of config.yml in the working directory and its
+// parents when set, and must then exist
+func GetConf(configFile string) error {
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("./..")
+		viper.AddConfigPath("./../..")
+		viper.SetConfigName("config")
+	}
 	viper.SetEnvPrefix("svc")
 
 	replacer := strings.NewReplacer(".", "_")
@@ -217,7 +914,12 @@ func GetConf() {
 
 	viper.AutomaticEnv()
 	err := viper.ReadInConfig()
-	if err != nil {
+	switch {
+	case err != nil && configFile != "":
+		return err
+	case err != nil:
 		log.Warnf("%v", err)
 	}
+
+	return nil
 }
@@ -5,15 +5,69 @@ import "time"
 const (
 	DefaultHTTPTimeout             = 10 * time.Second
 	DefaultHTTPTLSHandshakeTimeout = 5 * time.Second
-	DefaultTLSInsecureSkipVerify   = true
 
 	DefaultMigrationSleepInterval             = time.Second
 	DefaultBackupSleepInterval                = time.Second
 	DefaultRestoreSleepInterval               = time.Second
+	DefaultRestoreSnapshotSleepInterval       = time.Second
+	DefaultReindexSleepInterval               = time.Second
 	DefaultSleepIntervalForCollectionDeletion = time.Second
 
 	DefaultMigrationBatchSize             = 100
 	DefaultBackupBatchSize                = 100
 	DefaultRestoreBatchSize               = 100
+	DefaultRestoreSnapshotBatchSize       = 100
+	DefaultReindexBatchSize               = 100
 	DefaultBatchSizeForCollectionDeletion = 100
+
+	DefaultRestoreMaxLineSize         = 16 << 20
+	DefaultRestoreSnapshotMaxLineSize = 16 << 20
+
+	DefaultMigrationWorkers = 1
+	DefaultRestoreWorkers   = 1
+	DefaultReindexWorkers   = 1
+
+	DefaultBackupMode        = BackupModeSearch
+	DefaultBackupCompression = CompressionNone
+
+	DefaultMigrationRejectedFilePath = "rejected.jsonl"
+	DefaultRestoreRejectedFilePath   = "rejected.jsonl"
+
+	DefaultMigrationSyncPollInterval  = time.Minute
+	DefaultMigrationSyncStateFilePath = "sync_state.json"
+
+	DefaultMigrationSyncReconcileMaxDeletions = 1000
+
+	DefaultSnapshotCompression             = CompressionNone
+	DefaultSnapshotMaxDocsPerFile          = 10000
+	DefaultRestoreSnapshotRejectedFilePath = "rejected.jsonl"
+
+	DefaultReindexRejectedFilePath = "rejected.jsonl"
+
+	DefaultVerifyReportFilePath = "verify_report.jsonl"
+	DefaultVerifyMaxFieldDiffs  = 1000
+	DefaultVerifySortBatchSize  = 100000
+
+	DefaultStorageS3Endpoint = "s3.amazonaws.com"
+)
+
+const (
+	BackupModeSearch = "search"
+	BackupModeExport = "export"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+const (
+	TransformRename = "rename"
+	TransformDrop   = "drop"
+	TransformSet    = "set"
+	TransformCoerce = "coerce"
+	TransformSplit  = "split"
+	TransformJoin   = "join"
+	TransformDerive = "derive"
 )
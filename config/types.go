@@ -0,0 +1,40 @@
+package config
+
+import "time"
+
+// FieldType pairs a collection field name with a Typesense field type
+type FieldType struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+}
+
+// Transform is a single document transformation rule, the attributes used depend on its type
+type Transform struct {
+	Type      string `mapstructure:"type"`
+	Field     string `mapstructure:"field"`
+	To        string `mapstructure:"to"`
+	As        string `mapstructure:"as"`
+	Value     any    `mapstructure:"value"`
+	Separator string `mapstructure:"separator"`
+	Template  string `mapstructure:"template"`
+}
+
+// TypesenseConnection holds the settings used to reach a Typesense server, taken from the typesense settings of a
+// config section or from the cluster it names
+type TypesenseConnection struct {
+	Host                string
+	APIKey              string
+	Timeout             time.Duration
+	TLSHandshakeTimeout time.Duration
+	TLS                 TLSSettings
+}
+
+// TLSSettings configures how the certificate of a Typesense server is verified and the client certificate presented to
+// it for mutual TLS
+type TLSSettings struct {
+	InsecureSkipVerify bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+}
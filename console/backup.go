@@ -2,9 +2,14 @@ package console
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -14,6 +19,7 @@ import (
 	"github.com/kumparan/go-utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
 	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
 	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
 )
@@ -26,109 +32,352 @@ var backupCmd = &cobra.Command{
 }
 
 func init() {
+	backupCmd.Flags().Bool("resume", false, "continue an interrupted backup from the checkpoint in backup.folder_path")
+	addTypesenseFlags(backupCmd, "", "backup")
+	addStringFlag(backupCmd, "collection", "backup.collection")
+	addStringFlag(backupCmd, "folder-path", "backup.folder_path")
+	addStringFlag(backupCmd, "mode", "backup.mode")
+	addStringFlag(backupCmd, "compression", "backup.compression")
+	addStringFlag(backupCmd, "filter", "backup.filter")
+	addStringFlag(backupCmd, "sorter", "backup.sorter")
+	addStringFlag(backupCmd, "cursor-field", "backup.cursor_field")
+	addIntFlag(backupCmd, "batch-size", "backup.batch_size")
+	addIntFlag(backupCmd, "max-docs-per-file", "backup.max_docs_per_file")
+	addDurationFlag(backupCmd, "sleep-interval", "backup.sleep_interval")
 	RootCmd.AddCommand(backupCmd)
 }
 
-func runBackup(_ *cobra.Command, _ []string) {
+func runBackup(cmd *cobra.Command, _ []string) {
 	err := validateBackupConfig()
 	if err != nil {
 		log.Error(err)
 		return
 	}
 
-	fmt.Printf("Typesense Host: %s\n", config.BackupTypesenseHost())
-	fmt.Printf("Typesense API Key: %s\n", config.BackupTypesenseAPIKey())
-	fmt.Printf("Collection Name: %s\n", config.BackupCollection())
-	fmt.Printf("Folder Path: %s\n", config.BackupFolderPath())
-	fmt.Printf("Batch Size: %d\n", config.BackupBatchSize())
-	fmt.Printf("Max Docs Per File: %d\n", config.BackupMaxDocsPerFile())
-	fmt.Printf("Filter: %s\n", config.BackupFilter())
-	fmt.Printf("Sorter: %s\n", config.BackupSorter())
-	fmt.Printf("Included Fields: %s\n", strings.Join(config.BackupIncludedFields(), ","))
-	fmt.Printf("Excluded Fields: %s\n", strings.Join(config.BackupExcludedFields(), ","))
-	fmt.Print("Do you want to proceed with these config? (yes/no): ")
-
-	var confirmation string
-	fmt.Scanln(&confirmation)
-	if confirmation != "yes" {
+	resume, _ := cmd.Flags().GetBool("resume")
+
+	ctx := context.TODO()
+	st, err := newStorage(ctx, config.BackupFolderPath())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if resume && !isResumableStorage(st) {
+		log.Errorf("backup to %s can not be resumed", st)
+		return
+	}
+
+	out := promptOutput(st)
+
+	fmt.Fprintf(out, "Typesense Host: %s\n", config.BackupTypesenseHost())
+	fmt.Fprintf(out, "Typesense API Key: %s\n", maskSecret(config.BackupTypesenseAPIKey()))
+	fmt.Fprintf(out, "Collection Name: %s\n", config.BackupCollection())
+	fmt.Fprintf(out, "Mode: %s\n", config.BackupMode())
+	fmt.Fprintf(out, "Compression: %s\n", config.BackupCompression())
+	fmt.Fprintf(out, "Folder Path: %s\n", config.BackupFolderPath())
+	fmt.Fprintf(out, "Batch Size: %d\n", config.BackupBatchSize())
+	fmt.Fprintf(out, "Max Docs Per File: %d\n", config.BackupMaxDocsPerFile())
+	fmt.Fprintf(out, "Filter: %s\n", config.BackupFilter())
+	fmt.Fprintf(out, "Sorter: %s\n", config.BackupSorter())
+	fmt.Fprintf(out, "Cursor Field: %s\n", config.BackupCursorField())
+	fmt.Fprintf(out, "Included Fields: %s\n", strings.Join(config.BackupIncludedFields(), ","))
+	fmt.Fprintf(out, "Excluded Fields: %s\n", strings.Join(config.BackupExcludedFields(), ","))
+	fmt.Fprintf(out, "Resume: %t\n", resume)
+	if config.BackupMode() == config.BackupModeExport && len(config.BackupSorter()) > 0 {
+		log.Warn("backup.sorter is ignored in export mode, documents are exported in collection order")
+	}
+	if config.BackupMode() == config.BackupModeExport && len(config.BackupCursorField()) > 0 {
+		log.Warn("backup.cursor_field is ignored in export mode, the export is streamed at once")
+	}
+	if config.BackupMode() == config.BackupModeSearch && len(config.BackupCursorField()) > 0 && len(config.BackupSorter()) > 0 {
+		log.Warn("backup.sorter is ignored, documents are sorted on backup.cursor_field")
+	}
+	if !confirmProceed(out, os.Stdin) {
 		log.Println("Export operation cancelled.")
 		return
 	}
 
-	var (
-		ctx        = context.TODO()
-		tsClient   = newTypesenseClient(config.BackupTypesenseHost(), config.BackupTypesenseAPIKey())
-		page       = 1
-		chunk      = make([]string, 0, config.BackupMaxDocsPerFile())
-		chunkCount = 0
-	)
+	checkpoint, err := loadBackupCheckpoint(st, resume)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	chunkWriter, err := resumeBackupChunkWriter(st, backupMaxDocsPerFile(st), config.BackupCompression(), checkpoint)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer chunkWriter.Close()
+
+	manifest := newBackupManifest()
+	manifest.StartedAt = checkpoint.StartedAt
+
+	if err := backupCollectionSchema(ctx, st); err != nil {
+		log.Error(err)
+		return
+	}
+
+	switch config.BackupMode() {
+	case config.BackupModeExport:
+		err = backupWithExport(ctx, st, chunkWriter, checkpoint)
+	default:
+		err = backupWithSearch(ctx, st, chunkWriter, checkpoint)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	manifest.Files = chunkWriter.files
+	if err := writeManifestFile(st, manifest); err != nil {
+		log.Error(err)
+		return
+	}
+
+	if err := removeBackupCheckpoint(st); err != nil {
+		log.Error(err)
+		return
+	}
+
+	log.Printf("Documents successfully exported to %s", st)
+}
+
+// backupMaxDocsPerFile does not split the documents streamed to stdout, since they end up in a single stream anyway
+func backupMaxDocsPerFile(st storage) int {
+	if _, ok := st.(*stdioStorage); ok {
+		return math.MaxInt
+	}
+
+	return config.BackupMaxDocsPerFile()
+}
+
+// loadBackupCheckpoint returns the checkpoint to continue from when resuming, or a fresh one otherwise
+func loadBackupCheckpoint(st storage, resume bool) (*backupCheckpoint, error) {
+	checkpoint, err := readBackupCheckpoint(st)
+	switch {
+	case err != nil:
+		return nil, err
+	case !resume && checkpoint != nil:
+		log.Warnf("found %s from a previous run, starting over since --resume is not set", backupCheckpointFileName)
+		return newBackupCheckpoint(), nil
+	case !resume:
+		return newBackupCheckpoint(), nil
+	case checkpoint == nil:
+		return nil, fmt.Errorf("no %s found in %s to resume from", backupCheckpointFileName, st)
+	}
+
+	if err := checkpoint.validate(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Resuming backup from chunk %d with %d documents already exported", checkpoint.ChunkCount, checkpoint.Documents)
+
+	return checkpoint, nil
+}
+
+func backupCollectionSchema(ctx context.Context, st storage) error {
+	logger := log.WithFields(log.Fields{
+		"context":         utils.DumpIncomingContext(ctx),
+		"collection":      config.BackupCollection(),
+		"typesenseHost":   config.BackupTypesenseHost(),
+		"typesenseAPIKey": maskSecret(config.BackupTypesenseAPIKey()),
+		"folderPath":      config.BackupFolderPath(),
+	})
+
+	tsClient, err := newTypesenseClient(config.BackupTypesenseConnection())
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	schema, err := fetchCollectionSchema(ctx, tsClient, config.BackupCollection())
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	if err := writeSchemaFile(st, schema); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	log.Printf("Collection schema successfully exported to file %s", schemaFileName)
+
+	return nil
+}
+
+func backupWithSearch(ctx context.Context, st storage, chunkWriter *backupChunkWriter, checkpoint *backupCheckpoint) error {
+	tsClient, err := newTypesenseClient(config.BackupTypesenseConnection())
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	page := checkpoint.NextPage
 
 	for {
-		searchParams := buildBackupSearchParams(page)
+		searchParams := buildBackupSearchParams(page, checkpoint.Cursor)
 
 		logger := log.WithFields(log.Fields{
 			"context":         utils.DumpIncomingContext(ctx),
 			"searchParams":    utils.Dump(searchParams),
 			"collection":      config.BackupCollection(),
 			"typesenseHost":   config.BackupTypesenseHost(),
-			"typesenseAPIKey": config.BackupTypesenseAPIKey(),
+			"typesenseAPIKey": maskSecret(config.BackupTypesenseAPIKey()),
 		})
 
-		searchResult, err := tsClient.SearchCollectionWithResponse(ctx, config.BackupCollection(), searchParams)
+		docs, err := searchBackupPage(ctx, tsClient, searchParams, checkpoint.Cursor)
 		switch {
 		case err != nil:
 			logger.Error(err)
-			return
-		case isTypesenseErrorResponse(searchResult):
-			err = dumpTypesenseSearchResponseError(searchResult)
-			logger.Error(err)
-			return
-		case len(*searchResult.JSON200.Hits) <= 0:
-			goto WriteRemainingData
+			return err
+		case len(docs) == 0:
+			return chunkWriter.Close()
 		}
 
-		for _, item := range *searchResult.JSON200.Hits {
-			doc, err := json.Marshal(*item.Document)
+		for _, item := range docs {
+			doc, err := json.Marshal(item)
 			if err != nil {
 				logger.Error(err)
-				return
+				return err
 			}
-			chunk = append(chunk, string(doc))
-		}
 
-		chunkTotalLines := len(chunk)
-		log.Printf("Chunk progress: %d/%d", chunkTotalLines, config.BackupMaxDocsPerFile())
-		if chunkTotalLines >= config.BackupMaxDocsPerFile() {
-			if err := writeChunkToFile(chunk, chunkCount); err != nil {
+			if err := chunkWriter.Write(doc); err != nil {
 				logger.Error(err)
-				return
+				return err
 			}
+		}
+
+		log.Printf("Chunk progress: %d/%d", chunkWriter.lineCount, config.BackupMaxDocsPerFile())
 
-			chunk = chunk[:0]
-			chunkCount++
+		if err := checkpoint.save(st, chunkWriter, page+1); err != nil {
+			logger.Error(err)
+			return err
 		}
 
 		time.Sleep(config.BackupSleepInterval())
 		page++
 	}
+}
+
+// searchBackupPage returns the documents of a page, moving the cursor past them when there is one
+func searchBackupPage(ctx context.Context, client typesense.APIClientInterface, searchParams *typesenseAPI.SearchCollectionParams, cursor *keysetCursor) ([]map[string]interface{}, error) {
+	if cursor != nil {
+		docs, keys, _, err := searchKeysetPage(ctx, client, config.BackupCollection(), searchParams, cursor.Field)
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.advance(keys); err != nil {
+			return nil, err
+		}
+		return docs, nil
+	}
+
+	searchResult, err := client.SearchCollectionWithResponse(ctx, config.BackupCollection(), searchParams)
+	switch {
+	case err != nil:
+		return nil, err
+	case isTypesenseErrorResponse(searchResult):
+		return nil, dumpTypesenseSearchResponseError(searchResult)
+	}
+
+	var docs []map[string]interface{}
+	for _, item := range *searchResult.JSON200.Hits {
+		docs = append(docs, *item.Document)
+	}
+
+	return docs, nil
+}
+
+// backupWithExport can not seek into the export stream, so when resuming the documents already exported are read and skipped
+func backupWithExport(ctx context.Context, st storage, chunkWriter *backupChunkWriter, checkpoint *backupCheckpoint) error {
+	exportParams := buildBackupExportParams()
+
+	logger := log.WithFields(log.Fields{
+		"context":         utils.DumpIncomingContext(ctx),
+		"exportParams":    utils.Dump(exportParams),
+		"collection":      config.BackupCollection(),
+		"typesenseHost":   config.BackupTypesenseHost(),
+		"typesenseAPIKey": maskSecret(config.BackupTypesenseAPIKey()),
+	})
+
+	tsClient, err := newTypesenseClientWithTimeout(config.BackupTypesenseConnection(), config.BackupExportTimeout())
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	resp, err := tsClient.ExportDocuments(ctx, config.BackupCollection(), exportParams)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = dumpTypesenseHTTPResponseError(resp)
+		logger.Error(err)
+		return err
+	}
+
+	var (
+		reader  = bufio.NewReader(resp.Body)
+		skipped = 0
+	)
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		doc := bytes.TrimSpace(line)
+		switch {
+		case len(doc) == 0:
+		case skipped < checkpoint.Documents:
+			skipped++
+		default:
+			if err := writeExportedDocument(st, chunkWriter, checkpoint, doc); err != nil {
+				logger.Error(err)
+				return err
+			}
+		}
 
-WriteRemainingData:
-	if len(chunk) > 0 {
-		if err := writeChunkToFile(chunk, chunkCount); err != nil {
-			log.Error(err)
-			return
+		switch {
+		case errors.Is(err, io.EOF):
+			return chunkWriter.Close()
+		case err != nil:
+			logger.Error(err)
+			return err
 		}
 	}
+}
 
-	log.Printf("Documents successfully exported to folder %s", config.BackupFolderPath())
+// writeExportedDocument saves a checkpoint every time a chunk file is full, the export stream is too fast to checkpoint every document
+func writeExportedDocument(st storage, chunkWriter *backupChunkWriter, checkpoint *backupCheckpoint, doc []byte) error {
+	if err := chunkWriter.Write(doc); err != nil {
+		return err
+	}
+
+	if chunkWriter.lineCount < chunkWriter.maxDocs {
+		return nil
+	}
+
+	return checkpoint.save(st, chunkWriter, checkpoint.NextPage)
 }
 
 func validateBackupConfig() error {
+	if err := validateClusterReference("backup", config.BackupCluster()); err != nil {
+		return err
+	}
+
 	parsedURL, err := url.Parse(config.BackupTypesenseHost())
 	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
 		return fmt.Errorf("invalid typesense host URL: %s", config.BackupTypesenseHost())
 	}
 
+	if err := validateTLSSettings("backup", config.BackupCluster(), config.BackupTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
 	switch {
 	case config.BackupTypesenseAPIKey() == "":
 		return fmt.Errorf("backup.typesense.api_key cannot be empty")
@@ -140,12 +389,17 @@ func validateBackupConfig() error {
 		return fmt.Errorf("backup.batch_size must be a positive integer")
 	case config.BackupMaxDocsPerFile() <= 0:
 		return fmt.Errorf("backup.max_docs_per_file must be a positive integer")
+	case config.BackupMode() != config.BackupModeSearch && config.BackupMode() != config.BackupModeExport:
+		return fmt.Errorf("backup.mode must be either %s or %s", config.BackupModeSearch, config.BackupModeExport)
+	case backupFileExtension(config.BackupCompression()) == "":
+		return fmt.Errorf("backup.compression must be one of %s, %s or %s", config.CompressionNone, config.CompressionGzip, config.CompressionZstd)
 	}
 
-	return nil
+	return validateCursorField("backup.cursor_field", config.BackupCursorField(), config.BackupIncludedFields(), config.BackupExcludedFields())
 }
 
-func buildBackupSearchParams(page int) (searchParams *typesenseAPI.SearchCollectionParams) {
+// buildBackupSearchParams returns the params of a page, or of the next page after the cursor when there is one
+func buildBackupSearchParams(page int, cursor *keysetCursor) (searchParams *typesenseAPI.SearchCollectionParams) {
 	searchParams = &typesenseAPI.SearchCollectionParams{
 		Q:       typesensePtr.String("*"),
 		PerPage: typesensePtr.Int(config.BackupBatchSize()),
@@ -167,39 +421,27 @@ func buildBackupSearchParams(page int) (searchParams *typesenseAPI.SearchCollect
 		searchParams.FilterBy = typesensePtr.String(config.BackupFilter())
 	}
 
+	if cursor != nil {
+		cursor.applyTo(searchParams, config.BackupFilter())
+	}
+
 	return
 }
 
-func writeChunkToFile(chunk []string, chunkCount int) error {
-	filename := fmt.Sprintf("%s/backup_chunk_%d.jsonl", config.BackupFolderPath(), chunkCount)
-	logger := log.WithField("filename", filename)
+func buildBackupExportParams() (exportParams *typesenseAPI.ExportDocumentsParams) {
+	exportParams = &typesenseAPI.ExportDocumentsParams{}
 
-	file, err := os.Create(filename)
-	if err != nil {
-		logger.Error(err)
-		return err
+	if len(config.BackupIncludedFields()) > 0 {
+		exportParams.IncludeFields = typesensePtr.String(strings.Join(config.BackupIncludedFields(), ","))
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	chunkTotalLines := len(chunk)
-	for i, line := range chunk {
-		if i+1 == chunkTotalLines {
-			if _, err := writer.WriteString(line); err != nil {
-				logger.Error(err)
-				return err
-			}
-			break
-		}
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			logger.Error(err)
-			return err
-		}
+	if len(config.BackupExcludedFields()) > 0 {
+		exportParams.ExcludeFields = typesensePtr.String(strings.Join(config.BackupExcludedFields(), ","))
 	}
 
-	writer.Flush()
-
-	log.Printf("Documents successfully exported to file %s", filename)
+	if len(config.BackupFilter()) > 0 {
+		exportParams.FilterBy = typesensePtr.String(config.BackupFilter())
+	}
 
-	return nil
+	return
 }
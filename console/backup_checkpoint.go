@@ -0,0 +1,142 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"typesense-migration-tools/config"
+)
+
+const backupCheckpointFileName = "backup_checkpoint.json"
+
+// backupCheckpoint records how far a backup went, so that it can be continued with --resume.
+// Everything up to ChunkBytes of the in-progress chunk file has been flushed to disk when the checkpoint is written.
+type backupCheckpoint struct {
+	Collection     string               `json:"collection"`
+	Mode           string               `json:"mode"`
+	Compression    string               `json:"compression"`
+	Filter         string               `json:"filter,omitempty"`
+	Sorter         string               `json:"sorter,omitempty"`
+	BatchSize      int                  `json:"batch_size"`
+	MaxDocsPerFile int                  `json:"max_docs_per_file"`
+	StartedAt      time.Time            `json:"started_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	NextPage       int                  `json:"next_page"`
+	Cursor         *keysetCursor        `json:"cursor,omitempty"`
+	Documents      int                  `json:"documents"`
+	ChunkCount     int                  `json:"chunk_count"`
+	ChunkLines     int                  `json:"chunk_lines"`
+	ChunkBytes     int64                `json:"chunk_bytes"`
+	Files          []backupManifestFile `json:"files"`
+}
+
+func newBackupCheckpoint() *backupCheckpoint {
+	checkpoint := &backupCheckpoint{
+		Collection:     config.BackupCollection(),
+		Mode:           config.BackupMode(),
+		Compression:    config.BackupCompression(),
+		Filter:         config.BackupFilter(),
+		Sorter:         config.BackupSorter(),
+		BatchSize:      config.BackupBatchSize(),
+		MaxDocsPerFile: config.BackupMaxDocsPerFile(),
+		StartedAt:      time.Now().UTC(),
+		NextPage:       1,
+	}
+	if field := backupCursorField(); field != "" {
+		checkpoint.Cursor = newKeysetCursor(field)
+	}
+
+	return checkpoint
+}
+
+// validate makes sure the checkpoint was written with the same config, otherwise pages and chunk files would not line up
+func (c *backupCheckpoint) validate() error {
+	switch {
+	case c.Collection != config.BackupCollection():
+		return fmt.Errorf("checkpoint collection %s does not match backup.collection %s", c.Collection, config.BackupCollection())
+	case c.Mode != config.BackupMode():
+		return fmt.Errorf("checkpoint mode %s does not match backup.mode %s", c.Mode, config.BackupMode())
+	case c.Compression != config.BackupCompression():
+		return fmt.Errorf("checkpoint compression %s does not match backup.compression %s", c.Compression, config.BackupCompression())
+	case c.Filter != config.BackupFilter():
+		return fmt.Errorf("checkpoint filter %s does not match backup.filter %s", c.Filter, config.BackupFilter())
+	case c.Sorter != config.BackupSorter():
+		return fmt.Errorf("checkpoint sorter %s does not match backup.sorter %s", c.Sorter, config.BackupSorter())
+	case c.BatchSize != config.BackupBatchSize():
+		return fmt.Errorf("checkpoint batch size %d does not match backup.batch_size %d", c.BatchSize, config.BackupBatchSize())
+	case c.MaxDocsPerFile != config.BackupMaxDocsPerFile():
+		return fmt.Errorf("checkpoint max docs per file %d does not match backup.max_docs_per_file %d", c.MaxDocsPerFile, config.BackupMaxDocsPerFile())
+	case c.cursorField() != backupCursorField():
+		return fmt.Errorf("checkpoint cursor field %s does not match backup.cursor_field %s", c.cursorField(), backupCursorField())
+	}
+
+	return nil
+}
+
+// backupCursorField returns backup.cursor_field, which only applies to the search mode
+func backupCursorField() string {
+	if config.BackupMode() != config.BackupModeSearch {
+		return ""
+	}
+
+	return config.BackupCursorField()
+}
+
+func (c *backupCheckpoint) cursorField() string {
+	if c.Cursor == nil {
+		return ""
+	}
+
+	return c.Cursor.Field
+}
+
+// save flushes the chunk writer and persists its position together with the next page to fetch,
+// nothing is saved when the storage can not be resumed
+func (c *backupCheckpoint) save(st storage, chunkWriter *backupChunkWriter, nextPage int) error {
+	if !isResumableStorage(st) {
+		return nil
+	}
+
+	if err := chunkWriter.Flush(); err != nil {
+		return err
+	}
+
+	c.NextPage = nextPage
+	c.Documents = chunkWriter.totalDocuments()
+	c.ChunkCount = chunkWriter.chunkCount
+	c.ChunkLines = chunkWriter.lineCount
+	c.ChunkBytes = chunkWriter.byteCount
+	c.Files = chunkWriter.files
+	c.UpdatedAt = time.Now().UTC()
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return st.WriteFile(backupCheckpointFileName, b)
+}
+
+// readBackupCheckpoint returns nil without error when the storage does not contain a checkpoint
+func readBackupCheckpoint(st storage) (*backupCheckpoint, error) {
+	b, err := st.ReadFile(backupCheckpointFileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	checkpoint := &backupCheckpoint{}
+	if err := json.Unmarshal(b, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", backupCheckpointFileName, err)
+	}
+
+	return checkpoint, nil
+}
+
+func removeBackupCheckpoint(st storage) error {
+	return st.Remove(backupCheckpointFileName)
+}
@@ -0,0 +1,247 @@
+package console
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// backupChunkFilePrefix starts the names of the files written by backupChunkWriter
+const backupChunkFilePrefix = "backup_chunk_"
+
+// backupChunkWriter writes documents into backup_chunk_N.jsonl files, moving on to the next file once maxDocs is reached.
+// Every closed file is recorded in files with its checksum, to be listed in the backup manifest.
+type backupChunkWriter struct {
+	storage     storage
+	maxDocs     int
+	compression string
+	chunkCount  int
+	lineCount   int
+	byteCount   int64
+	filename    string
+	file        io.WriteCloser
+	hash        hash.Hash
+	counter     *countingWriter
+	compressor  io.WriteCloser
+	writer      *bufio.Writer
+	files       []backupManifestFile
+}
+
+// countingWriter keeps track of the bytes written to the chunk file, after compression
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+func newBackupChunkWriter(st storage, maxDocs int, compression string) *backupChunkWriter {
+	return &backupChunkWriter{
+		storage:     st,
+		maxDocs:     maxDocs,
+		compression: compression,
+	}
+}
+
+// resumeBackupChunkWriter continues writing the chunk files described by the checkpoint, anything written to the
+// in-progress chunk after the checkpoint is discarded. Only local folders can be resumed, see isResumableStorage.
+func resumeBackupChunkWriter(st storage, maxDocs int, compression string, checkpoint *backupCheckpoint) (*backupChunkWriter, error) {
+	w := newBackupChunkWriter(st, maxDocs, compression)
+	w.chunkCount = checkpoint.ChunkCount
+	w.files = checkpoint.Files
+	if checkpoint.ChunkLines == 0 {
+		return w, nil
+	}
+
+	local, ok := st.(*localStorage)
+	if !ok {
+		return nil, fmt.Errorf("backup to %s can not be resumed", st)
+	}
+
+	w.filename = w.chunkFileName()
+	logger := log.WithField("filename", local.path(w.filename))
+
+	file, err := os.OpenFile(local.path(w.filename), os.O_RDWR, 0)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	if err := file.Truncate(checkpoint.ChunkBytes); err != nil {
+		logger.Error(err)
+		_ = file.Close()
+		return nil, err
+	}
+
+	w.hash = sha256.New()
+	size, err := io.Copy(w.hash, file)
+	switch {
+	case err != nil:
+		logger.Error(err)
+		_ = file.Close()
+		return nil, err
+	case size != checkpoint.ChunkBytes:
+		_ = file.Close()
+		return nil, fmt.Errorf("chunk file %s is shorter than the checkpoint, expected %d bytes, got %d bytes", w.filename, checkpoint.ChunkBytes, size)
+	}
+
+	w.file = file
+	w.counter = &countingWriter{writer: io.MultiWriter(file, w.hash), count: size}
+	w.writer = bufio.NewWriter(w.counter)
+	w.lineCount = checkpoint.ChunkLines
+	w.byteCount = size
+
+	return w, nil
+}
+
+// Write appends a single JSON document to the current chunk file
+func (w *backupChunkWriter) Write(doc []byte) error {
+	if w.file != nil && w.lineCount >= w.maxDocs {
+		if err := w.Close(); err != nil {
+			return err
+		}
+		w.chunkCount++
+	}
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.startCompressor(); err != nil {
+		return err
+	}
+
+	if w.lineCount > 0 {
+		if err := w.writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.writer.Write(doc); err != nil {
+		return err
+	}
+	w.lineCount++
+
+	return nil
+}
+
+// Flush writes the buffered documents of the current chunk file to disk. Compressed files are made of
+// concatenated gzip members or zstd frames, so the current one is completed to leave a file that can be
+// decompressed, and appended to when resuming.
+func (w *backupChunkWriter) Flush() error {
+	if w.file == nil {
+		return nil
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	if w.compressor != nil {
+		compressor := w.compressor
+		w.compressor = nil
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+
+	w.byteCount = w.counter.count
+
+	return nil
+}
+
+// Close flushes and closes the current chunk file, it is safe to call more than once
+func (w *backupChunkWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	logger := log.WithField("filename", w.filename)
+	if err := w.Flush(); err != nil {
+		logger.Error(err)
+		_ = w.file.Close()
+		w.file = nil
+		return err
+	}
+
+	file := w.file
+	w.file = nil
+	if err := file.Close(); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	w.files = append(w.files, backupManifestFile{
+		Name:      w.filename,
+		Documents: w.lineCount,
+		Bytes:     w.byteCount,
+		SHA256:    hex.EncodeToString(w.hash.Sum(nil)),
+	})
+	w.lineCount = 0
+	w.byteCount = 0
+
+	log.Printf("Documents successfully exported to file %s in %s", w.filename, w.storage)
+
+	return nil
+}
+
+func (w *backupChunkWriter) totalDocuments() int {
+	total := w.lineCount
+	for _, file := range w.files {
+		total += file.Documents
+	}
+
+	return total
+}
+
+func (w *backupChunkWriter) chunkFileName() string {
+	return fmt.Sprintf("%s%d%s", backupChunkFilePrefix, w.chunkCount, backupFileExtension(w.compression))
+}
+
+func (w *backupChunkWriter) open() error {
+	w.filename = w.chunkFileName()
+	w.lineCount = 0
+	w.byteCount = 0
+
+	file, err := w.storage.Create(w.filename)
+	if err != nil {
+		log.WithField("filename", w.filename).Error(err)
+		return err
+	}
+
+	w.file = file
+	w.hash = sha256.New()
+	w.counter = &countingWriter{writer: io.MultiWriter(file, w.hash)}
+	w.writer = bufio.NewWriter(w.counter)
+
+	return nil
+}
+
+// startCompressor begins a new gzip member or zstd frame, either for a new file or after a flush
+func (w *backupChunkWriter) startCompressor() error {
+	if w.compressor != nil {
+		return nil
+	}
+
+	compressor, err := newCompressWriter(w.compression, w.counter)
+	if err != nil || compressor == nil {
+		return err
+	}
+
+	w.compressor = compressor
+	w.writer.Reset(compressor)
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package console
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"typesense-migration-tools/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupChunkWriter(t *testing.T) {
+	t.Run("rotate chunk files on max docs", func(t *testing.T) {
+		dir := t.TempDir()
+		writer := newBackupChunkWriter(&localStorage{folderPath: dir}, 2, config.CompressionNone)
+
+		for _, doc := range []string{`{"id":"1"}`, `{"id":"2"}`, `{"id":"3"}`} {
+			require.NoError(t, writer.Write([]byte(doc)))
+		}
+		require.NoError(t, writer.Close())
+		require.NoError(t, writer.Close())
+
+		b, err := os.ReadFile(filepath.Join(dir, "backup_chunk_0.jsonl"))
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":\"1\"}\n{\"id\":\"2\"}", string(b))
+
+		b, err = os.ReadFile(filepath.Join(dir, "backup_chunk_1.jsonl"))
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":"3"}`, string(b))
+
+		require.Len(t, writer.files, 2)
+		assert.Equal(t, "backup_chunk_0.jsonl", writer.files[0].Name)
+		assert.Equal(t, 2, writer.files[0].Documents)
+		assert.Equal(t, int64(21), writer.files[0].Bytes)
+		assert.Equal(t, 1, writer.files[1].Documents)
+
+		manifest := &backupManifest{Files: writer.files}
+		assert.Empty(t, verifyBackupFiles(&localStorage{folderPath: dir}, manifest, []string{"backup_chunk_0.jsonl", "backup_chunk_1.jsonl"}))
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "backup_chunk_1.jsonl"), []byte(`{"id":"4"}`), 0o644))
+		assert.Len(t, verifyBackupFiles(&localStorage{folderPath: dir}, manifest, nil), 1)
+	})
+
+	t.Run("no file is created without documents", func(t *testing.T) {
+		dir := t.TempDir()
+		writer := newBackupChunkWriter(&localStorage{folderPath: dir}, 2, config.CompressionNone)
+		require.NoError(t, writer.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	for _, compression := range []string{config.CompressionGzip, config.CompressionZstd} {
+		t.Run("compress with "+compression+" across flushes", func(t *testing.T) {
+			dir := t.TempDir()
+			writer := newBackupChunkWriter(&localStorage{folderPath: dir}, 10, compression)
+
+			require.NoError(t, writer.Write([]byte(`{"id":"1"}`)))
+			require.NoError(t, writer.Flush())
+			require.NoError(t, writer.Write([]byte(`{"id":"2"}`)))
+			require.NoError(t, writer.Close())
+
+			st := &localStorage{folderPath: dir}
+			files, err := findBackupFiles(st)
+			require.NoError(t, err)
+			require.Equal(t, []string{"backup_chunk_0" + backupFileExtension(compression)}, files)
+
+			file, err := st.Open(files[0])
+			require.NoError(t, err)
+			defer file.Close()
+
+			reader, err := newDecompressReader(files[0], file)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			b, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, "{\"id\":\"1\"}\n{\"id\":\"2\"}", string(b))
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/typesense/typesense-go/v2/typesense"
+)
+
+// clusterResource is a kind of Typesense resource that snapshot saves as a JSON list and restore-snapshot upserts back one by one.
+// The raw JSON is kept so that attributes unknown to the client library survive the round trip.
+type clusterResource struct {
+	name     string
+	fileName string
+	// listKey is the attribute of the retrieve response holding the list
+	listKey string
+	// idKey is the attribute of each item holding its id, it is moved to the URL when upserting
+	idKey string
+	// optional resources are skipped with a warning when the cluster does not support them
+	optional bool
+	list     func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error)
+	// upsert is nil for resources that can not be restored
+	upsert func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error)
+}
+
+var stopwordsResource = clusterResource{
+	name:     "stopwords sets",
+	fileName: "stopwords.json",
+	listKey:  "stopwords",
+	idKey:    "id",
+	list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+		resp, err := client.RetrieveStopwordsSetsWithResponse(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+	upsert: func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error) {
+		resp, err := client.UpsertStopwordsSetWithBodyWithResponse(ctx, id, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+}
+
+var presetsResource = clusterResource{
+	name:     "presets",
+	fileName: "presets.json",
+	listKey:  "presets",
+	idKey:    "name",
+	list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+		resp, err := client.RetrieveAllPresetsWithResponse(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+	upsert: func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error) {
+		resp, err := client.UpsertPresetWithBodyWithResponse(ctx, id, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+}
+
+var aliasesResource = clusterResource{
+	name:     "aliases",
+	fileName: "aliases.json",
+	listKey:  "aliases",
+	idKey:    "name",
+	list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+		resp, err := client.GetAliasesWithResponse(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+	upsert: func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error) {
+		resp, err := client.UpsertAliasWithBodyWithResponse(ctx, id, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+}
+
+// analyticsRulesResource is optional since the analytics endpoints are only available when analytics is enabled on the cluster
+var analyticsRulesResource = clusterResource{
+	name:     "analytics rules",
+	fileName: "analytics_rules.json",
+	listKey:  "rules",
+	idKey:    "name",
+	optional: true,
+	list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+		resp, err := client.RetrieveAnalyticsRulesWithResponse(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+	upsert: func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error) {
+		resp, err := client.UpsertAnalyticsRuleWithBodyWithResponse(ctx, id, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+}
+
+// apiKeysResource only holds the key metadata, typesense never returns the key values after creation so they can not be restored
+var apiKeysResource = clusterResource{
+	name:     "API keys",
+	fileName: "api_keys.json",
+	listKey:  "keys",
+	idKey:    "id",
+	list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+		resp, err := client.GetKeysWithResponse(ctx)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode(), resp.Body, nil
+	},
+}
+
+func synonymsResource(collection string) clusterResource {
+	return clusterResource{
+		name:     "synonyms",
+		fileName: "synonyms.json",
+		listKey:  "synonyms",
+		idKey:    "id",
+		list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+			resp, err := client.GetSearchSynonymsWithResponse(ctx, collection)
+			if err != nil {
+				return 0, nil, err
+			}
+			return resp.StatusCode(), resp.Body, nil
+		},
+		upsert: func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error) {
+			resp, err := client.UpsertSearchSynonymWithBodyWithResponse(ctx, collection, id, "application/json", bytes.NewReader(body))
+			if err != nil {
+				return 0, nil, err
+			}
+			return resp.StatusCode(), resp.Body, nil
+		},
+	}
+}
+
+func overridesResource(collection string) clusterResource {
+	return clusterResource{
+		name:     "overrides",
+		fileName: "overrides.json",
+		listKey:  "overrides",
+		idKey:    "id",
+		list: func(ctx context.Context, client typesense.APIClientInterface) (int, []byte, error) {
+			resp, err := client.GetSearchOverridesWithResponse(ctx, collection)
+			if err != nil {
+				return 0, nil, err
+			}
+			return resp.StatusCode(), resp.Body, nil
+		},
+		upsert: func(ctx context.Context, client typesense.APIClientInterface, id string, body []byte) (int, []byte, error) {
+			resp, err := client.UpsertSearchOverrideWithBodyWithResponse(ctx, collection, id, "application/json", bytes.NewReader(body))
+			if err != nil {
+				return 0, nil, err
+			}
+			return resp.StatusCode(), resp.Body, nil
+		},
+	}
+}
+
+// fetchResources retrieves every item of the resource, optional resources not supported by the cluster return nil
+func fetchResources(ctx context.Context, client typesense.APIClientInterface, resource clusterResource) ([]map[string]any, error) {
+	status, body, err := resource.list(ctx, client)
+	switch {
+	case err != nil:
+		return nil, err
+	case status != http.StatusOK && resource.optional:
+		log.Warnf("skipping %s, typesense responded with code: %d, response: %s", resource.name, status, string(body))
+		return nil, nil
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("unexpected response from typesense while listing %s, code: %d, response: %s", resource.name, status, string(body))
+	}
+
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	var items []map[string]any
+	if raw, ok := response[resource.listKey]; ok {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+// upsertResources creates or replaces every item on the cluster, the items are sent as they were retrieved without their id
+func upsertResources(ctx context.Context, client typesense.APIClientInterface, resource clusterResource, items []map[string]any) error {
+	for _, item := range items {
+		id, body, err := resourceUpsertBody(resource, item)
+		if err != nil {
+			return err
+		}
+
+		status, respBody, err := resource.upsert(ctx, client, id, body)
+		switch {
+		case err != nil:
+			return err
+		case status != http.StatusOK && status != http.StatusCreated:
+			return fmt.Errorf("unexpected response from typesense while upserting %s %s, code: %d, response: %s", resource.name, id, status, string(respBody))
+		}
+	}
+
+	return nil
+}
+
+func resourceUpsertBody(resource clusterResource, item map[string]any) (string, []byte, error) {
+	id, ok := item[resource.idKey].(string)
+	if !ok || id == "" {
+		return "", nil, fmt.Errorf("%s item without %s: %v", resource.name, resource.idKey, item)
+	}
+
+	body := make(map[string]any, len(item))
+	for k, v := range item {
+		if k != resource.idKey {
+			body[k] = v
+		}
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, b, nil
+}
+
+func writeResourcesFile(st storage, resource clusterResource, items []map[string]any) error {
+	if items == nil {
+		items = []map[string]any{}
+	}
+
+	b, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return st.WriteFile(resource.fileName, b)
+}
+
+// readResourcesFile returns nil without error when the storage does not contain the resource file
+func readResourcesFile(st storage, resource clusterResource) ([]map[string]any, error) {
+	b, err := st.ReadFile(resource.fileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var items []map[string]any
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", resource.fileName, err)
+	}
+
+	return items, nil
+}
+
+// filterAliases keeps the aliases pointing to one of the given collections
+func filterAliases(aliases []map[string]any, collections map[string]bool) []map[string]any {
+	var filtered []map[string]any
+	for _, alias := range aliases {
+		if name, _ := alias["collection_name"].(string); collections[name] {
+			filtered = append(filtered, alias)
+		}
+	}
+
+	return filtered
+}
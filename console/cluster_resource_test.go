@@ -0,0 +1,31 @@
+package console
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterResource(t *testing.T) {
+	t.Run("move the id out of the upsert body", func(t *testing.T) {
+		id, body, err := resourceUpsertBody(presetsResource, map[string]any{"name": "listing", "value": map[string]any{"q": "*"}})
+		require.NoError(t, err)
+		assert.Equal(t, "listing", id)
+		assert.JSONEq(t, `{"value":{"q":"*"}}`, string(body))
+
+		_, _, err = resourceUpsertBody(stopwordsResource, map[string]any{"stopwords": []string{"a"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("keep the aliases of the given collections", func(t *testing.T) {
+		aliases := []map[string]any{
+			{"name": "articles", "collection_name": "articles_v2"},
+			{"name": "users", "collection_name": "users_v1"},
+		}
+
+		filtered := filterAliases(aliases, map[string]bool{"articles_v2": true})
+		require.Len(t, filtered, 1)
+		assert.Equal(t, "articles", filtered[0]["name"])
+	})
+}
@@ -0,0 +1,32 @@
+package console
+
+import (
+	"fmt"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+)
+
+// validateClusterReference checks that the cluster named by a config section is described in the clusters settings,
+// and that the section does not also set its own typesense settings, which the cluster would silently replace. Flags
+// are explicit overrides for one run: --cluster replaces the typesense settings of the section, while --host and
+// --api-key override the ones of the cluster.
+func validateClusterReference(section, cluster string) error {
+	switch {
+	case cluster == "":
+		return nil
+	case !config.ClusterDefined(cluster):
+		return fmt.Errorf("%s.cluster: cluster %s is not defined in clusters", section, cluster)
+	case config.IsSetByFlag(section + ".cluster"):
+		return nil
+	}
+
+	for _, name := range []string{"host", "api_key"} {
+		key := section + ".typesense." + name
+		if viper.GetString(key) != "" && !config.IsSetByFlag(key) {
+			return fmt.Errorf("%s.cluster and %s.typesense cannot be both set", section, section)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterReference(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+http_connection_settings:
+  timeout: "10s"
+clusters:
+  prod-sg:
+    host: "https://prod-sg:8108"
+    api_key: "prod-key"
+    tls_handshake_timeout: "2s"
+backup:
+  cluster: "prod-sg"
+restore:
+  typesense:
+    host: "http://local:8108"
+    api_key: "local-key"
+`)))
+
+	t.Run("read the connection of the named cluster", func(t *testing.T) {
+		assert.NoError(t, validateClusterReference("backup", config.BackupCluster()))
+		assert.Equal(t, config.TypesenseConnection{
+			Host:                "https://prod-sg:8108",
+			APIKey:              "prod-key",
+			Timeout:             10 * time.Second,
+			TLSHandshakeTimeout: 2 * time.Second,
+		}, config.BackupTypesenseConnection())
+	})
+
+	t.Run("read the typesense settings of a section without cluster", func(t *testing.T) {
+		assert.NoError(t, validateClusterReference("restore", config.RestoreCluster()))
+		assert.Equal(t, "http://local:8108", config.RestoreTypesenseHost())
+		assert.Equal(t, "local-key", config.RestoreTypesenseAPIKey())
+	})
+
+	t.Run("reject an undefined cluster", func(t *testing.T) {
+		viper.Set("backup.cluster", "prod-us")
+		t.Cleanup(func() { viper.Set("backup.cluster", "prod-sg") })
+
+		assert.EqualError(t, validateClusterReference("backup", config.BackupCluster()), "backup.cluster: cluster prod-us is not defined in clusters")
+	})
+
+	t.Run("reject a cluster and typesense settings in the same section", func(t *testing.T) {
+		viper.Set("restore.cluster", "prod-sg")
+
+		assert.EqualError(t, validateClusterReference("restore", config.RestoreCluster()), "restore.cluster and restore.typesense cannot be both set")
+	})
+}
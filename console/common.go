@@ -2,8 +2,9 @@ package console
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"time"
 	"typesense-migration-tools/config"
 
 	"github.com/kumparan/go-connect"
@@ -12,25 +13,47 @@ import (
 	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
 )
 
-func newHTTPClient() *http.Client {
-	return connect.NewHTTPConnection(&connect.HTTPConnectionOptions{
-		TLSHandshakeTimeout:   config.HTTPTLSHandshakeTimeout(),
-		Timeout:               config.HTTPTimeout(),
-		TLSInsecureSkipVerify: config.DefaultTLSInsecureSkipVerify, //nolint:gosec
+func newHTTPClient(connection config.TypesenseConnection) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(connection.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	client := connect.NewHTTPConnection(&connect.HTTPConnectionOptions{
+		TLSHandshakeTimeout: connection.TLSHandshakeTimeout,
+		Timeout:             connection.Timeout,
 	})
+	// go-connect only sets whether the certificate is verified, the CA, client certificate and server name are set on
+	// its transport
+	client.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+
+	return client, nil
 }
 
-func newTypesenseClient(host, apiKey string) typesense.APIClientInterface {
+// newTypesenseClient fails on invalid TLS settings, which the validate*Config functions already report before the
+// confirmation prompt
+func newTypesenseClient(connection config.TypesenseConnection) (typesense.APIClientInterface, error) {
+	httpClient, err := newHTTPClient(connection)
+	if err != nil {
+		return nil, err
+	}
+
 	cli, err := typesenseAPI.NewClientWithResponses(
-		host,
-		typesenseAPI.WithAPIKey(apiKey),
-		typesenseAPI.WithHTTPClient(newHTTPClient()),
+		connection.Host,
+		typesenseAPI.WithAPIKey(connection.APIKey),
+		typesenseAPI.WithHTTPClient(httpClient),
 	)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return cli
+	return cli, nil
+}
+
+// newTypesenseClientWithTimeout is used for long-lived requests such as document export, where the whole body is streamed
+func newTypesenseClientWithTimeout(connection config.TypesenseConnection, timeout time.Duration) (typesense.APIClientInterface, error) {
+	connection.Timeout = timeout
+	return newTypesenseClient(connection)
 }
 
 func isTypesenseErrorResponse(response *typesenseAPI.SearchCollectionResponse) bool {
@@ -41,6 +64,11 @@ func dumpTypesenseSearchResponseError(response *typesenseAPI.SearchCollectionRes
 	return fmt.Errorf("unexpected response from typesense, code: %d, response: %s", response.StatusCode(), string(response.Body))
 }
 
+func dumpTypesenseHTTPResponseError(response *http.Response) error {
+	body, _ := io.ReadAll(response.Body)
+	return fmt.Errorf("unexpected response from typesense, code: %d, response: %s", response.StatusCode, string(body))
+}
+
 func dumpTypesenseError(messages ...any) error {
 	errorMsg := ""
 	for _, v := range messages {
@@ -0,0 +1,158 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"typesense-migration-tools/config"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var backupFileExtensions = map[string]string{
+	config.CompressionNone: ".jsonl",
+	config.CompressionGzip: ".jsonl.gz",
+	config.CompressionZstd: ".jsonl.zst",
+}
+
+func backupFileExtension(compression string) string {
+	return backupFileExtensions[compression]
+}
+
+// newCompressWriter returns nil without error when no compression is configured
+func newCompressWriter(compression string, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case config.CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case config.CompressionZstd:
+		return zstd.NewWriter(w)
+	case config.CompressionNone:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported compression: %s", compression)
+}
+
+// newDecompressReader picks the decompression from the file extension, so that a folder can mix compressed and plain files.
+// Stdin has no extension, the compression is detected from its first bytes instead.
+func newDecompressReader(name string, r io.Reader) (io.ReadCloser, error) {
+	compression := config.CompressionNone
+	switch {
+	case strings.HasSuffix(name, backupFileExtensions[config.CompressionGzip]):
+		compression = config.CompressionGzip
+	case strings.HasSuffix(name, backupFileExtensions[config.CompressionZstd]):
+		compression = config.CompressionZstd
+	case name == stdioFileName:
+		bufReader := bufio.NewReader(r)
+		compression = detectCompression(bufReader)
+		r = bufReader
+	}
+
+	switch compression {
+	case config.CompressionGzip:
+		return gzip.NewReader(r)
+	case config.CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(r), nil
+}
+
+var (
+	gzipMagicNumber = []byte{0x1f, 0x8b}
+	zstdMagicNumber = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func detectCompression(r *bufio.Reader) string {
+	header, _ := r.Peek(len(zstdMagicNumber))
+	switch {
+	case bytes.HasPrefix(header, gzipMagicNumber):
+		return config.CompressionGzip
+	case bytes.HasPrefix(header, zstdMagicNumber):
+		return config.CompressionZstd
+	}
+
+	return config.CompressionNone
+}
+
+// findBackupFiles lists the backup files of a storage in natural order: the backup_chunk_N files and the files listed in
+// the manifest. Other JSONL files of the folder, such as a dead-letter file or a verify report, are not backup data.
+func findBackupFiles(st storage) ([]string, error) {
+	names, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readManifestFile(st)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+	if manifest != nil {
+		for _, file := range manifest.Files {
+			listed[file.Name] = true
+		}
+	}
+
+	outputs := outputFileNames()
+
+	var files []string
+	for _, name := range names {
+		switch {
+		case name == stdioFileName:
+			files = append(files, name)
+		case slices.Contains(outputs, name):
+			continue
+		case listed[name] || isBackupChunkFileName(name):
+			files = append(files, name)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return naturalLess(files[i], files[j])
+	})
+
+	return files, nil
+}
+
+func isBackupChunkFileName(name string) bool {
+	if !strings.HasPrefix(name, backupChunkFilePrefix) {
+		return false
+	}
+
+	for _, ext := range backupFileExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// outputFileNames returns the names of the dead-letter and report files the commands write, which are never backup
+// files even when written into a backup folder
+func outputFileNames() []string {
+	var names []string
+	for _, filePath := range []string{
+		config.MigrationRejectedFilePath(),
+		config.RestoreRejectedFilePath(),
+		config.RestoreSnapshotRejectedFilePath(),
+		config.ReindexRejectedFilePath(),
+		config.VerifyReportFilePath(),
+	} {
+		names = append(names, filepath.Base(filePath))
+	}
+
+	return names
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 	"typesense-migration-tools/config"
@@ -12,6 +13,7 @@ import (
 	"github.com/kumparan/go-utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
 	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
 	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
 )
@@ -24,6 +26,11 @@ var deleteCollectionCmd = &cobra.Command{
 }
 
 func init() {
+	addTypesenseFlags(deleteCollectionCmd, "", "delete_collection")
+	addStringFlag(deleteCollectionCmd, "collection", "delete_collection.collection")
+	addStringFlag(deleteCollectionCmd, "sorter", "delete_collection.sorter")
+	addIntFlag(deleteCollectionCmd, "batch-size", "delete_collection.batch_size")
+	addDurationFlag(deleteCollectionCmd, "sleep-interval", "delete_collection.sleep_interval")
 	RootCmd.AddCommand(deleteCollectionCmd)
 }
 
@@ -35,118 +42,158 @@ func runDeleteCollection(_ *cobra.Command, _ []string) {
 	}
 
 	fmt.Printf("Typesense Host: %s\n", config.TypesenseHostForCollectionDeletion())
-	fmt.Printf("Typesense API Key: %s\n", config.TypesenseAPIKeyForCollectionDeletion())
+	fmt.Printf("Typesense API Key: %s\n", maskSecret(config.TypesenseAPIKeyForCollectionDeletion()))
 	fmt.Printf("Collection Name: %s\n", config.CollectionNameToDelete())
 	fmt.Printf("Batch Size: %d\n", config.BatchSizeForCollectionDeletion())
 	fmt.Printf("Excluded Fields: %s\n", strings.Join(config.ExcludedFieldsForCollectionDeletion(), ","))
-	fmt.Print("Do you want to proceed with these config? (yes/no): ")
-
-	var confirmation string
-	fmt.Scanln(&confirmation)
-	if confirmation != "yes" {
+	if !confirmProceed(os.Stdout, os.Stdin) {
 		log.Println("Export operation cancelled.")
 		return
 	}
 
-	var (
-		ctx      = context.TODO()
-		tsClient = newTypesenseClient(config.TypesenseHostForCollectionDeletion(), config.TypesenseAPIKeyForCollectionDeletion())
-	)
+	ctx := context.TODO()
+	tsClient, err := newTypesenseClient(config.TypesenseConnectionForCollectionDeletion())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	deletion := &collectionDeletion{
+		client:         tsClient,
+		collection:     config.CollectionNameToDelete(),
+		batchSize:      config.BatchSizeForCollectionDeletion(),
+		sorter:         config.SorterForCollectionDeletion(),
+		excludedFields: config.ExcludedFieldsForCollectionDeletion(),
+		sleepInterval:  config.SleepIntervalForCollectionDeletion(),
+	}
+	if err := deletion.run(ctx); err != nil {
+		return
+	}
+
+	log.Printf("Collection %s successfully deleted", config.CollectionNameToDelete())
+}
 
+// collectionDeletion empties a collection batch by batch before dropping it, so that a large collection is not deleted in one go
+type collectionDeletion struct {
+	client         typesense.APIClientInterface
+	collection     string
+	batchSize      int
+	sorter         string
+	excludedFields []string
+	sleepInterval  time.Duration
+}
+
+// run deletes the documents and then the collection, errors are logged before being returned
+func (d *collectionDeletion) run(ctx context.Context) error {
 	logger := log.WithFields(log.Fields{
 		"context":          utils.DumpIncomingContext(ctx),
-		"sourceCollection": config.CollectionNameToDelete(),
+		"sourceCollection": d.collection,
 	})
 
 	for {
-		searchParams := buildSearchParamsForCollectionDeletion()
+		searchParams := d.searchParams()
 		logger = logger.WithField("searchParams", utils.Dump(searchParams))
 
-		searchResult, err := tsClient.SearchCollectionWithResponse(ctx, config.CollectionNameToDelete(), searchParams)
-		switch {
-		case err != nil:
-			logger.Error(err)
-			return
-		case isTypesenseErrorResponse(searchResult):
-			err = dumpTypesenseSearchResponseError(searchResult)
+		done, err := d.deleteBatch(ctx, logger, searchParams)
+		if err != nil {
 			logger.Error(err)
-			return
-		case len(*searchResult.JSON200.Hits) <= 0:
-			goto DeleteCollection
+			return err
+		}
+		if done {
+			break
 		}
 
-		var ids []string
-		for _, item := range *searchResult.JSON200.Hits {
-			doc := *item.Document
-			docID, ok := doc["id"].(string)
-			if !ok {
-				continue
-			}
+		time.Sleep(d.sleepInterval)
+	}
 
-			ids = append(ids, docID)
-		}
+	logger.Infof("start deleting collection: %s", d.collection)
 
-		logger.Infof("start deleting documents with ids: %s", fmt.Sprintf("id:=[%s]", strings.Join(ids, ",")))
+	resp, err := d.client.DeleteCollectionWithResponse(ctx, d.collection)
+	switch {
+	case err != nil:
+		logger.Error(err)
+		return err
+	case resp.StatusCode() != http.StatusOK:
+		err = dumpTypesenseError(resp.JSON404)
+		logger.Error(err)
+		return err
+	}
 
-		resp, err := tsClient.DeleteDocumentsWithResponse(ctx, config.CollectionNameToDelete(), &typesenseAPI.DeleteDocumentsParams{
-			BatchSize: typesensePtr.Int(config.BatchSizeForCollectionDeletion()),
-			FilterBy:  typesensePtr.String(fmt.Sprintf("id:=[%s]", strings.Join(ids, ","))),
-		})
-		switch {
-		case err != nil:
-			logger.Error(err)
-			return
-		case resp.StatusCode() != http.StatusOK:
-			err = dumpTypesenseError(resp.JSON404)
-			logger.Error(err)
-			return
+	return nil
+}
+
+// deleteBatch deletes the documents of the first page and reports whether the collection was already empty
+func (d *collectionDeletion) deleteBatch(ctx context.Context, logger *log.Entry, searchParams *typesenseAPI.SearchCollectionParams) (bool, error) {
+	searchResult, err := d.client.SearchCollectionWithResponse(ctx, d.collection, searchParams)
+	switch {
+	case err != nil:
+		return false, err
+	case isTypesenseErrorResponse(searchResult):
+		return false, dumpTypesenseSearchResponseError(searchResult)
+	case len(*searchResult.JSON200.Hits) <= 0:
+		return true, nil
+	}
+
+	var ids []string
+	for _, item := range *searchResult.JSON200.Hits {
+		doc := *item.Document
+		docID, ok := doc["id"].(string)
+		if !ok {
+			continue
 		}
 
-		time.Sleep(config.SleepIntervalForCollectionDeletion())
+		ids = append(ids, docID)
 	}
 
-DeleteCollection:
-	logger.Infof("start deleting collection: %s", config.CollectionNameToDelete())
+	logger.Infof("start deleting documents with ids: %s", fmt.Sprintf("id:=[%s]", strings.Join(ids, ",")))
 
-	resp, err := tsClient.DeleteCollectionWithResponse(ctx, config.CollectionNameToDelete())
+	resp, err := d.client.DeleteDocumentsWithResponse(ctx, d.collection, &typesenseAPI.DeleteDocumentsParams{
+		BatchSize: typesensePtr.Int(d.batchSize),
+		FilterBy:  typesensePtr.String(fmt.Sprintf("id:=[%s]", strings.Join(ids, ","))),
+	})
 	switch {
 	case err != nil:
-		logger.Error(err)
-		return
+		return false, err
 	case resp.StatusCode() != http.StatusOK:
-		err = dumpTypesenseError(resp.JSON404)
-		logger.Error(err)
-		return
+		return false, dumpTypesenseError(resp.JSON404)
 	}
 
-	log.Printf("Collection %s successfully deleted", config.CollectionNameToDelete())
+	return false, nil
 }
 
-func buildSearchParamsForCollectionDeletion() (searchParams *typesenseAPI.SearchCollectionParams) {
+func (d *collectionDeletion) searchParams() (searchParams *typesenseAPI.SearchCollectionParams) {
 	searchParams = &typesenseAPI.SearchCollectionParams{
 		Q:             typesensePtr.String("*"),
-		PerPage:       typesensePtr.Int(config.BatchSizeForCollectionDeletion()),
+		PerPage:       typesensePtr.Int(d.batchSize),
 		Page:          typesensePtr.Int(1),
 		IncludeFields: typesensePtr.String("id"),
 	}
 
-	if len(config.ExcludedFieldsForCollectionDeletion()) > 0 {
-		searchParams.ExcludeFields = typesensePtr.String(strings.Join(config.ExcludedFieldsForCollectionDeletion(), ","))
+	if len(d.excludedFields) > 0 {
+		searchParams.ExcludeFields = typesensePtr.String(strings.Join(d.excludedFields, ","))
 	}
 
-	if config.SorterForCollectionDeletion() != "" {
-		searchParams.SortBy = typesensePtr.String(config.SorterForCollectionDeletion())
+	if d.sorter != "" {
+		searchParams.SortBy = typesensePtr.String(d.sorter)
 	}
 
 	return
 }
 
 func validateCollectionDeletionConfig() error {
+	if err := validateClusterReference("delete_collection", config.ClusterForCollectionDeletion()); err != nil {
+		return err
+	}
+
 	parsedURL, err := url.Parse(config.TypesenseHostForCollectionDeletion())
 	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
 		return fmt.Errorf("invalid typesense host URL: %s", config.TypesenseHostForCollectionDeletion())
 	}
 
+	if err := validateTLSSettings("delete_collection", config.ClusterForCollectionDeletion(), config.TypesenseConnectionForCollectionDeletion().TLS); err != nil {
+		return err
+	}
+
 	switch {
 	case config.TypesenseAPIKeyForCollectionDeletion() == "":
 		return fmt.Errorf("delete_collection.typesense.api_key cannot be empty")
@@ -0,0 +1,72 @@
+package console
+
+import (
+	"fmt"
+	"io"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configKeyAnnotation marks the flags overriding a config key, they are bound to viper when their command runs, since
+// commands sharing a config section, such as migrate and sync, declare flags for the same keys
+const configKeyAnnotation = "config_key"
+
+func addStringFlag(cmd *cobra.Command, name, key string) {
+	cmd.Flags().String(name, "", "override "+key)
+	_ = cmd.Flags().SetAnnotation(name, configKeyAnnotation, []string{key})
+}
+
+func addIntFlag(cmd *cobra.Command, name, key string) {
+	cmd.Flags().Int(name, 0, "override "+key)
+	_ = cmd.Flags().SetAnnotation(name, configKeyAnnotation, []string{key})
+}
+
+func addDurationFlag(cmd *cobra.Command, name, key string) {
+	cmd.Flags().Duration(name, 0, "override "+key)
+	_ = cmd.Flags().SetAnnotation(name, configKeyAnnotation, []string{key})
+}
+
+// addTypesenseFlags adds the --<prefix>cluster, --<prefix>host and --<prefix>api-key flags of the typesense connection
+// of a config section
+func addTypesenseFlags(cmd *cobra.Command, prefix, section string) {
+	addStringFlag(cmd, prefix+"cluster", section+".cluster")
+	addStringFlag(cmd, prefix+"host", section+".typesense.host")
+	addStringFlag(cmd, prefix+"api-key", section+".typesense.api_key")
+}
+
+// bindConfigFlags binds the flags of the command to their config key, a flag only takes precedence over the config
+// file and the environment when it is set. The keys of the flags set are recorded, so that --host and --api-key
+// override the cluster of their section.
+func bindConfigFlags(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		key, ok := flag.Annotations[configKeyAnnotation]
+		if !ok || err != nil {
+			return
+		}
+		if flag.Changed {
+			config.SetByFlag(key[0])
+		}
+		err = viper.BindPFlag(key[0], flag)
+	})
+
+	return err
+}
+
+// confirmProceed asks whether to proceed with the config printed before and reads the answer from input, it is
+// answered without reading when --yes is set
+func confirmProceed(out io.Writer, input io.Reader) bool {
+	fmt.Fprint(out, "Do you want to proceed with these config? (yes/no): ")
+	if config.AssumeYes() {
+		fmt.Fprintln(out, "yes")
+		return true
+	}
+
+	var confirmation string
+	fmt.Fscanln(input, &confirmation)
+
+	return confirmation == "yes"
+}
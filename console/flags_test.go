@@ -0,0 +1,71 @@
+package console
+
+import (
+	"strings"
+	"testing"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindConfigFlags(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(config.ResetFlags)
+
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader("test:\n  typesense:\n    host: http://config:8108\n  batch_size: 100\n")))
+
+	cmd := &cobra.Command{Use: "test"}
+	addTypesenseFlags(cmd, "", "test")
+	addIntFlag(cmd, "batch-size", "test.batch_size")
+	require.NoError(t, cmd.ParseFlags([]string{"--host", "http://flag:8108"}))
+	require.NoError(t, bindConfigFlags(cmd))
+
+	assert.Equal(t, "http://flag:8108", viper.GetString("test.typesense.host"))
+	assert.Equal(t, 100, viper.GetInt("test.batch_size"))
+	assert.Equal(t, "", viper.GetString("test.typesense.api_key"))
+}
+
+func TestTypesenseFlagsOverrideTheCluster(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Cleanup(config.ResetFlags)
+
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+clusters:
+  prod-sg:
+    host: "https://prod-sg:8108"
+    api_key: "prod-key"
+backup:
+  cluster: "prod-sg"
+restore:
+  typesense:
+    host: "http://local:8108"
+    api_key: "local-key"
+`)))
+
+	t.Run("override the host of the cluster", func(t *testing.T) {
+		cmd := &cobra.Command{Use: "backup"}
+		addTypesenseFlags(cmd, "", "backup")
+		require.NoError(t, cmd.ParseFlags([]string{"--host", "https://prod-sg-replica:8108"}))
+		require.NoError(t, bindConfigFlags(cmd))
+
+		assert.NoError(t, validateClusterReference("backup", config.BackupCluster()))
+		assert.Equal(t, "https://prod-sg-replica:8108", config.BackupTypesenseHost())
+		assert.Equal(t, "prod-key", config.BackupTypesenseAPIKey())
+	})
+
+	t.Run("replace the typesense settings of the section by the cluster", func(t *testing.T) {
+		cmd := &cobra.Command{Use: "restore"}
+		addTypesenseFlags(cmd, "", "restore")
+		require.NoError(t, cmd.ParseFlags([]string{"--cluster", "prod-sg"}))
+		require.NoError(t, bindConfigFlags(cmd))
+
+		assert.NoError(t, validateClusterReference("restore", config.RestoreCluster()))
+		assert.Equal(t, "https://prod-sg:8108", config.RestoreTypesenseHost())
+		assert.Equal(t, "prod-key", config.RestoreTypesenseAPIKey())
+	})
+}
@@ -0,0 +1,163 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+)
+
+// rejectedDocument is a line of the dead-letter file, holding a document refused by the import endpoint
+type rejectedDocument struct {
+	Error    string          `json:"error"`
+	Document json.RawMessage `json:"document"`
+}
+
+// importResultTracker counts the per-document results of the import endpoint, which responds with 200 even when
+// some documents are refused, and writes the refused documents to a dead-letter file. It is safe for concurrent use
+// by the import workers.
+type importResultTracker struct {
+	mu               sync.Mutex
+	rejectedFilePath string
+	maxFailureRatio  float64
+	succeeded        int
+	failed           int
+	file             *os.File
+	writer           *bufio.Writer
+}
+
+func newImportResultTracker(rejectedFilePath string, maxFailureRatio float64) *importResultTracker {
+	return &importResultTracker{
+		rejectedFilePath: rejectedFilePath,
+		maxFailureRatio:  maxFailureRatio,
+	}
+}
+
+// track parses the import response body, one JSON result per line in the same order as the sent documents,
+// and returns an error once the ratio of refused documents exceeds maxFailureRatio
+func (t *importResultTracker) track(responseBody, sentBody []byte) error {
+	sentDocs := bytes.Split(bytes.TrimSpace(sentBody), []byte("\n"))
+	results := bytes.Split(bytes.TrimSpace(responseBody), []byte("\n"))
+	if len(results) != len(sentDocs) {
+		log.Warnf("typesense returned %d import results for %d documents", len(results), len(sentDocs))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, line := range results {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var result typesenseAPI.ImportDocumentResponse
+		if err := json.Unmarshal(line, &result); err != nil {
+			return fmt.Errorf("invalid import result %s: %w", string(line), err)
+		}
+
+		if result.Success {
+			t.succeeded++
+			continue
+		}
+
+		t.failed++
+		doc := []byte(result.Document)
+		if i < len(sentDocs) {
+			doc = sentDocs[i]
+		}
+		if err := t.writeRejected(result.Error, doc); err != nil {
+			return err
+		}
+	}
+
+	return t.checkFailureRatioLocked()
+}
+
+// reject writes a document refused before reaching typesense, such as one failing a transform. The failure ratio is
+// checked by the next call to track or checkFailureRatio, so that the refused documents are weighed against the imported ones.
+func (t *importResultTracker) reject(doc []byte, cause error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failed++
+	return t.writeRejected(cause.Error(), doc)
+}
+
+func (t *importResultTracker) checkFailureRatio() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.checkFailureRatioLocked()
+}
+
+func (t *importResultTracker) checkFailureRatioLocked() error {
+	if ratio := t.failureRatio(); ratio > t.maxFailureRatio {
+		return fmt.Errorf("%d of %d documents were rejected, failure ratio %.4f exceeds %.4f, see %s",
+			t.failed, t.succeeded+t.failed, ratio, t.maxFailureRatio, t.rejectedFilePath)
+	}
+
+	return nil
+}
+
+func (t *importResultTracker) failureRatio() float64 {
+	total := t.succeeded + t.failed
+	if total == 0 {
+		return 0
+	}
+
+	return float64(t.failed) / float64(total)
+}
+
+func (t *importResultTracker) writeRejected(errMsg string, doc []byte) error {
+	if t.file == nil {
+		file, err := os.OpenFile(t.rejectedFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+
+		t.file = file
+		t.writer = bufio.NewWriter(file)
+	}
+
+	rejected := rejectedDocument{Error: errMsg, Document: doc}
+	if !json.Valid(doc) {
+		rejected.Document, _ = json.Marshal(string(doc))
+	}
+
+	b, err := json.Marshal(rejected)
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.writer.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	return t.writer.Flush()
+}
+
+// Close closes the dead-letter file and logs a summary of the import results
+func (t *importResultTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failed > 0 {
+		log.Warnf("%d documents imported, %d documents rejected and written to %s", t.succeeded, t.failed, t.rejectedFilePath)
+	} else {
+		log.Printf("%d documents imported without rejection", t.succeeded)
+	}
+
+	if t.file == nil {
+		return nil
+	}
+
+	file := t.file
+	t.file = nil
+
+	return file.Close()
+}
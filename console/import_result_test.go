@@ -0,0 +1,48 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportResultTracker(t *testing.T) {
+	sent := []byte("{\"id\":\"1\"}\n{\"id\":\"2\"}\n{\"id\":\"3\"}\n{\"id\":\"4\"}\n")
+	response := []byte(`{"success":true}
+{"success":false,"error":"Field title has been declared in the schema, but is not found in the document.","document":"{\"id\":\"2\"}"}
+{"success":true}
+{"success":true}`)
+
+	t.Run("write rejected documents and stay under the ratio", func(t *testing.T) {
+		rejectedFilePath := filepath.Join(t.TempDir(), "rejected.jsonl")
+		tracker := newImportResultTracker(rejectedFilePath, 0.5)
+
+		require.NoError(t, tracker.track(response, sent))
+		require.NoError(t, tracker.Close())
+		assert.Equal(t, 3, tracker.succeeded)
+		assert.Equal(t, 1, tracker.failed)
+
+		b, err := os.ReadFile(rejectedFilePath)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"error":"Field title has been declared in the schema, but is not found in the document.","document":{"id":"2"}}`, string(b))
+	})
+
+	t.Run("fail when the ratio is exceeded", func(t *testing.T) {
+		tracker := newImportResultTracker(filepath.Join(t.TempDir(), "rejected.jsonl"), 0)
+		defer tracker.Close()
+
+		assert.Error(t, tracker.track(response, sent))
+	})
+
+	t.Run("no rejected file without rejection", func(t *testing.T) {
+		rejectedFilePath := filepath.Join(t.TempDir(), "rejected.jsonl")
+		tracker := newImportResultTracker(rejectedFilePath, 0)
+
+		require.NoError(t, tracker.track([]byte(`{"success":true}`), []byte(`{"id":"1"}`)))
+		require.NoError(t, tracker.Close())
+		assert.NoFileExists(t, rejectedFilePath)
+	})
+}
@@ -0,0 +1,176 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/typesense/typesense-go/v2/typesense"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
+)
+
+// keysetCursor pages through the documents sorted on a numeric field by filtering on the last value seen instead of
+// asking for a page number, so that deep pages cost as much as the first one and documents inserted below the cursor
+// do not shift the pages. The ids already seen with the last value break the ties between documents sharing it.
+type keysetCursor struct {
+	Field string      `json:"field"`
+	Value json.Number `json:"value,omitempty"`
+	IDs   []string    `json:"ids,omitempty"`
+}
+
+// maxKeysetTieIDs bounds the ids excluded by the cursor filter, they are all sent with every search while documents
+// share the cursor value
+const maxKeysetTieIDs = 1000
+
+// keysetKey is the position of a document in the keyset order
+type keysetKey struct {
+	id    string
+	value json.Number
+}
+
+func newKeysetCursor(field string) *keysetCursor {
+	return &keysetCursor{Field: field}
+}
+
+// applyTo turns the search params into the next keyset page, the filter is combined with the cursor position
+func (c *keysetCursor) applyTo(searchParams *typesenseAPI.SearchCollectionParams, filter string) {
+	searchParams.Page = typesensePtr.Int(1)
+	searchParams.SortBy = typesensePtr.String(c.Field + ":asc")
+	searchParams.FilterBy = nil
+
+	if filter = joinFilters(filter, c.filter()); filter != "" {
+		searchParams.FilterBy = typesensePtr.String(filter)
+	}
+}
+
+func (c *keysetCursor) filter() string {
+	if c.Value == "" {
+		return ""
+	}
+
+	position := fmt.Sprintf("%s:>=%s", c.Field, c.Value)
+	if len(c.IDs) == 0 {
+		return position
+	}
+
+	return joinFilters(position, excludeIDsFilter(c.IDs))
+}
+
+// advance moves the cursor past the keys of a page, which are sorted on the cursor field. It fails once more than
+// maxKeysetTieIDs documents share a value, rather than sending an ever larger filter.
+func (c *keysetCursor) advance(keys []keysetKey) error {
+	for _, key := range keys {
+		if key.value != c.Value {
+			c.Value = key.value
+			c.IDs = nil
+		}
+		c.IDs = append(c.IDs, key.id)
+	}
+
+	if len(c.IDs) > maxKeysetTieIDs {
+		return fmt.Errorf("more than %d documents share %s:%s, the cursor field needs more distinct values", maxKeysetTieIDs, c.Field, c.Value)
+	}
+
+	return nil
+}
+
+// searchKeysetPage runs a search and returns the documents together with their keyset keys. The keys are decoded
+// separately as json.Number, since nanosecond timestamps exceed float64 precision, while the documents keep the
+// float64 numbers the transforms expect.
+func searchKeysetPage(ctx context.Context, client typesense.APIClientInterface, collection string, searchParams *typesenseAPI.SearchCollectionParams, field string) ([]map[string]any, []keysetKey, int, error) {
+	resp, err := client.SearchCollection(ctx, collection, searchParams)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, 0, dumpTypesenseHTTPResponseError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var result struct {
+		Found int `json:"found"`
+		Hits  []struct {
+			Document map[string]any `json:"document"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, nil, 0, err
+	}
+
+	keys, err := decodeKeysetKeys(body, field)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	docs := make([]map[string]any, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		docs = append(docs, hit.Document)
+	}
+
+	return docs, keys, result.Found, nil
+}
+
+func decodeKeysetKeys(body []byte, field string) ([]keysetKey, error) {
+	var result struct {
+		Hits []struct {
+			Document map[string]any `json:"document"`
+		} `json:"hits"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	keys := make([]keysetKey, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		id, ok := hit.Document["id"].(string)
+		if !ok {
+			return nil, fmt.Errorf("document without id, the cursor can not move past it")
+		}
+
+		value, ok := hit.Document[field].(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("field %s of document %s must be numeric to be used as cursor, got %v", field, id, hit.Document[field])
+		}
+
+		keys = append(keys, keysetKey{id: id, value: value})
+	}
+
+	return keys, nil
+}
+
+// excludeIDsFilter matches every document but the given ids, quoted like idFilter
+func excludeIDsFilter(ids []string) string {
+	return "id:!=" + strings.TrimPrefix(idFilter(ids), "id:=")
+}
+
+// validateCursorField makes sure the cursor field and the id breaking its ties are returned with the documents
+func validateCursorField(key, field string, includedFields, excludedFields []string) error {
+	if field == "" {
+		return nil
+	}
+
+	for _, name := range []string{field, "id"} {
+		switch {
+		case len(includedFields) > 0 && !slices.Contains(includedFields, name):
+			return fmt.Errorf("%s %s needs %s to be part of the included fields", key, field, name)
+		case slices.Contains(excludedFields, name):
+			return fmt.Errorf("%s %s needs %s not to be part of the excluded fields", key, field, name)
+		}
+	}
+
+	return nil
+}
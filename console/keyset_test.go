@@ -0,0 +1,59 @@
+package console
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
+)
+
+func TestKeysetCursor(t *testing.T) {
+	t.Run("start without position", func(t *testing.T) {
+		searchParams := &typesenseAPI.SearchCollectionParams{Page: typesensePtr.Int(3), SortBy: typesensePtr.String("n:desc")}
+		newKeysetCursor("created_at").applyTo(searchParams, "")
+
+		assert.Equal(t, 1, *searchParams.Page)
+		assert.Equal(t, "created_at:asc", *searchParams.SortBy)
+		assert.Nil(t, searchParams.FilterBy)
+	})
+
+	t.Run("keep the ids seen with the last value", func(t *testing.T) {
+		cursor := newKeysetCursor("created_at")
+		require.NoError(t, cursor.advance([]keysetKey{{id: "a", value: "1"}, {id: "b", value: "2"}, {id: "c", value: "2"}}))
+		assert.Equal(t, "2", cursor.Value.String())
+		assert.Equal(t, []string{"b", "c"}, cursor.IDs)
+
+		require.NoError(t, cursor.advance([]keysetKey{{id: "d", value: "2"}}))
+		assert.Equal(t, []string{"b", "c", "d"}, cursor.IDs)
+
+		require.NoError(t, cursor.advance([]keysetKey{{id: "e", value: "1700000000000000001"}}))
+		assert.Equal(t, []string{"e"}, cursor.IDs)
+	})
+
+	t.Run("combine the position with the filter", func(t *testing.T) {
+		cursor := &keysetCursor{Field: "created_at", Value: "1700000000000000001", IDs: []string{"e"}}
+		searchParams := &typesenseAPI.SearchCollectionParams{}
+		cursor.applyTo(searchParams, "status:=published")
+
+		assert.Equal(t, "(status:=published) && ((created_at:>=1700000000000000001) && (id:!=[`e`]))", *searchParams.FilterBy)
+	})
+
+	t.Run("fail once too many documents share a value", func(t *testing.T) {
+		keys := make([]keysetKey, maxKeysetTieIDs+1)
+		for i := range keys {
+			keys[i] = keysetKey{id: fmt.Sprint(i), value: "7"}
+		}
+
+		assert.EqualError(t, newKeysetCursor("created_at").advance(keys), "more than 1000 documents share created_at:7, the cursor field needs more distinct values")
+	})
+}
+
+func TestValidateCursorField(t *testing.T) {
+	assert.NoError(t, validateCursorField("backup.cursor_field", "created_at", []string{"id", "created_at"}, nil))
+	assert.EqualError(t, validateCursorField("backup.cursor_field", "created_at", []string{"title"}, nil), "backup.cursor_field created_at needs created_at to be part of the included fields")
+	assert.EqualError(t, validateCursorField("backup.cursor_field", "created_at", []string{"created_at"}, nil), "backup.cursor_field created_at needs id to be part of the included fields")
+	assert.EqualError(t, validateCursorField("backup.cursor_field", "created_at", nil, []string{"id"}), "backup.cursor_field created_at needs id not to be part of the excluded fields")
+}
@@ -0,0 +1,135 @@
+package console
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"typesense-migration-tools/config"
+)
+
+const manifestFileName = "manifest.json"
+
+// backupManifest describes a complete backup folder, it is only written once every chunk file has been flushed
+type backupManifest struct {
+	ToolVersion    string               `json:"tool_version"`
+	TypesenseHost  string               `json:"typesense_host"`
+	Collection     string               `json:"collection"`
+	Mode           string               `json:"mode"`
+	Compression    string               `json:"compression"`
+	Filter         string               `json:"filter,omitempty"`
+	Sorter         string               `json:"sorter,omitempty"`
+	IncludedFields []string             `json:"included_fields,omitempty"`
+	ExcludedFields []string             `json:"excluded_fields,omitempty"`
+	StartedAt      time.Time            `json:"started_at"`
+	FinishedAt     time.Time            `json:"finished_at"`
+	TotalDocuments int                  `json:"total_documents"`
+	Files          []backupManifestFile `json:"files"`
+}
+
+type backupManifestFile struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Bytes     int64  `json:"bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+func newBackupManifest() *backupManifest {
+	return &backupManifest{
+		ToolVersion:    Version,
+		TypesenseHost:  config.BackupTypesenseHost(),
+		Collection:     config.BackupCollection(),
+		Mode:           config.BackupMode(),
+		Compression:    config.BackupCompression(),
+		Filter:         config.BackupFilter(),
+		Sorter:         config.BackupSorter(),
+		IncludedFields: config.BackupIncludedFields(),
+		ExcludedFields: config.BackupExcludedFields(),
+		StartedAt:      time.Now().UTC(),
+	}
+}
+
+func writeManifestFile(st storage, manifest *backupManifest) error {
+	manifest.FinishedAt = time.Now().UTC()
+	manifest.TotalDocuments = 0
+	for _, file := range manifest.Files {
+		manifest.TotalDocuments += file.Documents
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return st.WriteFile(manifestFileName, b)
+}
+
+// readManifestFile returns nil without error when the storage does not contain a manifest
+func readManifestFile(st storage) (*backupManifest, error) {
+	b, err := st.ReadFile(manifestFileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	manifest := &backupManifest{}
+	if err := json.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestFileName, err)
+	}
+
+	return manifest, nil
+}
+
+// verifyBackupFiles checks that every file listed in the manifest is present with the expected size and checksum,
+// and that the storage does not contain backup files unknown to the manifest
+func verifyBackupFiles(st storage, manifest *backupManifest, files []string) (errs []error) {
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, expected := range manifest.Files {
+		listed[expected.Name] = true
+
+		size, checksum, err := fileChecksum(st, expected.Name)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			errs = append(errs, fmt.Errorf("file %s is listed in %s but missing", expected.Name, manifestFileName))
+			continue
+		case err != nil:
+			errs = append(errs, err)
+			continue
+		}
+
+		if size != expected.Bytes || checksum != expected.SHA256 {
+			errs = append(errs, fmt.Errorf("file %s does not match %s, expected %d bytes with sha256 %s, got %d bytes with sha256 %s",
+				expected.Name, manifestFileName, expected.Bytes, expected.SHA256, size, checksum))
+		}
+	}
+
+	for _, file := range files {
+		if !listed[file] {
+			errs = append(errs, fmt.Errorf("file %s is not listed in %s", file, manifestFileName))
+		}
+	}
+
+	return
+}
+
+func fileChecksum(st storage, name string) (int64, string, error) {
+	file, err := st.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -8,6 +8,7 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 	"typesense-migration-tools/config"
@@ -15,6 +16,7 @@ import (
 	"github.com/kumparan/go-utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
 	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
 	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
 )
@@ -27,9 +29,25 @@ var migrateCmd = &cobra.Command{
 }
 
 func init() {
+	addMigrationFlags(migrateCmd)
 	RootCmd.AddCommand(migrateCmd)
 }
 
+// addMigrationFlags adds the flags of the migration settings shared by migrate and sync
+func addMigrationFlags(cmd *cobra.Command) {
+	addTypesenseFlags(cmd, "source-", "migration.source")
+	addTypesenseFlags(cmd, "destination-", "migration.destination")
+	addStringFlag(cmd, "source-collection", "migration.source.collection")
+	addStringFlag(cmd, "destination-collection", "migration.destination.collection")
+	addStringFlag(cmd, "filter", "migration.filter")
+	addStringFlag(cmd, "sorter", "migration.sorter")
+	addStringFlag(cmd, "cursor-field", "migration.cursor_field")
+	addStringFlag(cmd, "transform-script", "migration.transform_script")
+	addIntFlag(cmd, "batch-size", "migration.batch_size")
+	addIntFlag(cmd, "workers", "migration.workers")
+	addDurationFlag(cmd, "sleep-interval", "migration.sleep_interval")
+}
+
 func runMigrate(_ *cobra.Command, _ []string) {
 	err := validateMigrationConfig()
 	if err != nil {
@@ -38,130 +56,390 @@ func runMigrate(_ *cobra.Command, _ []string) {
 	}
 
 	fmt.Printf("Source Typesense Host: %s\n", config.MigrationSourceTypesenseHost())
-	fmt.Printf("Source Typesense API Key: %s\n", config.MigrationSourceTypesenseAPIKey())
+	fmt.Printf("Source Typesense API Key: %s\n", maskSecret(config.MigrationSourceTypesenseAPIKey()))
 	fmt.Printf("Source Collection Name: %s\n", config.MigrationSourceCollection())
 	fmt.Printf("Destination Typesense Host: %s\n", config.MigrationDestinationTypesenseHost())
-	fmt.Printf("Destination Typesense API Key: %s\n", config.MigrationDestinationTypesenseAPIKey())
+	fmt.Printf("Destination Typesense API Key: %s\n", maskSecret(config.MigrationDestinationTypesenseAPIKey()))
 	fmt.Printf("Destination Collection Name: %s\n", config.MigrationDestinationCollection())
 	fmt.Printf("Filter: %s\n", config.MigrationFilter())
 	fmt.Printf("Sorter: %s\n", config.MigrationSorter())
+	fmt.Printf("Cursor Field: %s\n", config.MigrationCursorField())
 	fmt.Printf("Included Fields: %s\n", strings.Join(config.MigrationIncludedFields(), ","))
 	fmt.Printf("Excluded Fields: %s\n", strings.Join(config.MigrationExcludedFields(), ","))
 	fmt.Printf("Batch Size: %d\n", config.MigrationBatchSize())
-	fmt.Print("Do you want to proceed with these config? (yes/no): ")
-
-	var confirmation string
-	fmt.Scanln(&confirmation)
-	if confirmation != "yes" {
+	fmt.Printf("Workers: %d\n", config.MigrationWorkers())
+	fmt.Printf("Create Destination Collection: %t\n", config.MigrationDestinationCreateCollection())
+	fmt.Printf("Transforms: %d\n", len(config.MigrationTransforms()))
+	fmt.Printf("Transform Script: %s\n", config.MigrationTransformScript())
+	if config.MigrationCursorField() != "" && config.MigrationSorter() != "" {
+		log.Warn("migration.sorter is ignored, documents are sorted on migration.cursor_field")
+	}
+	if !confirmProceed(os.Stdout, os.Stdin) {
 		log.Println("Export operation cancelled.")
 		return
 	}
 
+	sourceTypesenseClient, destinationTypesenseClient, err := newMigrationClients()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
 	var (
-		ctx                        = context.TODO()
-		sourceTypesenseClient      = newTypesenseClient(config.MigrationSourceTypesenseHost(), config.MigrationSourceTypesenseAPIKey())
-		destinationTypesenseClient = newTypesenseClient(config.MigrationDestinationTypesenseHost(), config.MigrationDestinationTypesenseAPIKey())
-		page                       = 1
+		ctx           = context.TODO()
+		importResults = newImportResultTracker(config.MigrationRejectedFilePath(), config.MigrationMaxFailureRatio())
 	)
+	defer importResults.Close()
 
-	for {
-		searchParams := buildMigrationSearchParams(page)
-
-		logger := log.WithFields(log.Fields{
-			"context":                    utils.DumpIncomingContext(ctx),
-			"searchParams":               utils.Dump(searchParams),
-			"sourceCollection":           config.MigrationSourceCollection(),
-			"destinationCollection":      config.MigrationDestinationCollection(),
-			"sourceTypesenseHost":        config.MigrationSourceTypesenseHost(),
-			"destinationTypesenseHost":   config.MigrationDestinationTypesenseHost(),
-			"sourceTypesenseAPIKey":      config.MigrationSourceTypesenseAPIKey(),
-			"destinationTypesenseAPIKey": config.MigrationDestinationTypesenseAPIKey(),
-		})
+	if config.MigrationDestinationCreateCollection() {
+		if err := ensureMigrationDestinationCollection(ctx, sourceTypesenseClient, destinationTypesenseClient); err != nil {
+			log.Error(err)
+			return
+		}
+	}
 
-		searchResult, err := sourceTypesenseClient.SearchCollectionWithResponse(ctx, config.MigrationSourceCollection(), searchParams)
+	job := newMigrationJob(sourceTypesenseClient, destinationTypesenseClient, importResults)
+	if err := job.run(ctx); err != nil {
+		return
+	}
+
+	log.Printf("Documents successfully migrated from %s to %s", config.MigrationSourceCollection(), config.MigrationDestinationCollection())
+}
+
+// newMigrationClients returns the clients of the source and destination Typesense servers of the migration settings
+func newMigrationClients() (typesense.APIClientInterface, typesense.APIClientInterface, error) {
+	sourceClient, err := newTypesenseClient(config.MigrationSourceTypesenseConnection())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	destinationClient, err := newTypesenseClient(config.MigrationDestinationTypesenseConnection())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sourceClient, destinationClient, nil
+}
+
+// migrationJob pages through the documents of a source collection and upserts them, transformed, into a destination
+// collection. The pages are read in order while up to workers of them are transformed and imported concurrently.
+type migrationJob struct {
+	sourceClient               typesense.APIClientInterface
+	destinationClient          typesense.APIClientInterface
+	sourceCollection           string
+	destinationCollection      string
+	sourceTypesenseHost        string
+	destinationTypesenseHost   string
+	sourceTypesenseAPIKey      string
+	destinationTypesenseAPIKey string
+	filter                     string
+	sorter                     string
+	cursorField                string
+	cursorStart                json.Number
+	includedFields             []string
+	excludedFields             []string
+	batchSize                  int
+	sleepInterval              time.Duration
+	workers                    int
+	transforms                 []config.Transform
+	transformScript            string
+	importResults              *importResultTracker
+}
+
+// newMigrationJob returns the job described by the migration settings
+func newMigrationJob(sourceClient, destinationClient typesense.APIClientInterface, importResults *importResultTracker) *migrationJob {
+	return &migrationJob{
+		sourceClient:               sourceClient,
+		destinationClient:          destinationClient,
+		sourceCollection:           config.MigrationSourceCollection(),
+		destinationCollection:      config.MigrationDestinationCollection(),
+		sourceTypesenseHost:        config.MigrationSourceTypesenseHost(),
+		destinationTypesenseHost:   config.MigrationDestinationTypesenseHost(),
+		sourceTypesenseAPIKey:      config.MigrationSourceTypesenseAPIKey(),
+		destinationTypesenseAPIKey: config.MigrationDestinationTypesenseAPIKey(),
+		filter:                     config.MigrationFilter(),
+		sorter:                     config.MigrationSorter(),
+		cursorField:                config.MigrationCursorField(),
+		includedFields:             config.MigrationIncludedFields(),
+		excludedFields:             config.MigrationExcludedFields(),
+		batchSize:                  config.MigrationBatchSize(),
+		sleepInterval:              config.MigrationSleepInterval(),
+		workers:                    config.MigrationWorkers(),
+		transforms:                 config.MigrationTransforms(),
+		transformScript:            config.MigrationTransformScript(),
+		importResults:              importResults,
+	}
+}
+
+// run migrates every page until the search returns no more hits, errors are logged before being returned
+func (j *migrationJob) run(ctx context.Context) error {
+	pipeline, err := newImportPipeline(j.workers, j.newTransformer, j.importBatch)
+	if err != nil {
+		j.logger(ctx).Error(err)
+		return err
+	}
+
+	if err := pipeline.run(ctx, j.readPages); err != nil {
+		j.logger(ctx).Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (j *migrationJob) logger(ctx context.Context) *log.Entry {
+	return log.WithFields(log.Fields{
+		"context":                    utils.DumpIncomingContext(ctx),
+		"sourceCollection":           j.sourceCollection,
+		"destinationCollection":      j.destinationCollection,
+		"sourceTypesenseHost":        j.sourceTypesenseHost,
+		"destinationTypesenseHost":   j.destinationTypesenseHost,
+		"sourceTypesenseAPIKey":      maskSecret(j.sourceTypesenseAPIKey),
+		"destinationTypesenseAPIKey": maskSecret(j.destinationTypesenseAPIKey),
+	})
+}
+
+func (j *migrationJob) newTransformer() (*documentTransformer, error) {
+	return newDocumentTransformer(j.transforms, j.transformScript)
+}
+
+// readPages emits the pages of the source collection until the search returns no more hits
+func (j *migrationJob) readPages(ctx context.Context, emit func(job importJob) error) error {
+	var cursor *keysetCursor
+	if j.cursorField != "" {
+		cursor = newKeysetCursor(j.cursorField)
+		cursor.Value = j.cursorStart
+	}
+
+	for page := 1; ; page++ {
+		searchParams := j.searchParams(page, cursor)
+
+		docs, found, err := j.searchPage(ctx, searchParams, cursor)
 		switch {
 		case err != nil:
-			logger.Error(err)
-			return
-		case isTypesenseErrorResponse(searchResult):
-			err = dumpTypesenseSearchResponseError(searchResult)
-			logger.Error(err)
-			return
-		case len(*searchResult.JSON200.Hits) <= 0:
-			goto LogSuccess
+			return err
+		case len(docs) == 0:
+			return nil
 		}
 
-		var docs []map[string]interface{}
-		for _, item := range *searchResult.JSON200.Hits {
-			docs = append(docs, *item.Document)
+		// a cursor search only counts the documents left
+		pages := int64(math.Ceil(float64(found) / float64(j.batchSize)))
+		if cursor != nil {
+			pages += int64(page - 1)
 		}
+		j.logger(ctx).WithField("searchParams", utils.Dump(searchParams)).Infof("start migrating page: %d/%d", page, pages)
 
-		logger.Infof("start migrating page: %d/%d", page, int64(math.Ceil(float64(*searchResult.JSON200.Found)/float64(config.MigrationBatchSize()))))
-		var buf bytes.Buffer
-		jsonEncoder := json.NewEncoder(&buf)
-		for _, doc := range docs {
-			if doc == nil {
-				continue
-			}
-
-			if err = jsonEncoder.Encode(doc); err != nil {
-				return
-			}
+		err = emit(importJob{
+			seq: page - 1,
+			prepare: func(transformer *documentTransformer) ([]byte, int, error) {
+				buf, count, err := encodeMigrationDocuments(docs, transformer, j.importResults)
+				if err != nil {
+					return nil, 0, err
+				}
+				return buf.Bytes(), count, nil
+			},
+		})
+		if err != nil {
+			return err
 		}
+	}
+}
 
-		if buf.Len() <= 0 {
-			return
+// searchPage returns the documents of a page with the number of documents found, moving the cursor past them when
+// there is one
+func (j *migrationJob) searchPage(ctx context.Context, searchParams *typesenseAPI.SearchCollectionParams, cursor *keysetCursor) ([]map[string]interface{}, int, error) {
+	if cursor != nil {
+		docs, keys, found, err := searchKeysetPage(ctx, j.sourceClient, j.sourceCollection, searchParams, cursor.Field)
+		if err != nil {
+			return nil, 0, err
 		}
+		if err := cursor.advance(keys); err != nil {
+			return nil, 0, err
+		}
+		return docs, found, nil
+	}
 
-		var resp *typesenseAPI.ImportDocumentsResponse
-		resp, err = destinationTypesenseClient.ImportDocumentsWithBodyWithResponse(ctx, config.MigrationDestinationCollection(), &typesenseAPI.ImportDocumentsParams{
-			Action:    typesensePtr.String("upsert"),
-			BatchSize: typesensePtr.Int(len(docs)),
-		}, "application/octet-stream", &buf)
-		switch {
-		case err != nil:
-			logger.Error(err)
-			return
-		case resp.StatusCode() != http.StatusOK:
-			err = dumpTypesenseError(resp.JSON400, resp.JSON404)
-			logger.Error(err)
-			return
+	searchResult, err := j.sourceClient.SearchCollectionWithResponse(ctx, j.sourceCollection, searchParams)
+	switch {
+	case err != nil:
+		return nil, 0, err
+	case isTypesenseErrorResponse(searchResult):
+		return nil, 0, dumpTypesenseSearchResponseError(searchResult)
+	}
+
+	var docs []map[string]interface{}
+	for _, item := range *searchResult.JSON200.Hits {
+		docs = append(docs, *item.Document)
+	}
+
+	return docs, *searchResult.JSON200.Found, nil
+}
+
+// importBatch upserts a page into the destination collection, a page left empty by the transforms only checks the failure ratio
+func (j *migrationJob) importBatch(ctx context.Context, data []byte, count int) error {
+	if count == 0 {
+		return j.importResults.checkFailureRatio()
+	}
+
+	resp, err := j.destinationClient.ImportDocumentsWithBodyWithResponse(ctx, j.destinationCollection, &typesenseAPI.ImportDocumentsParams{
+		Action:    typesensePtr.String("upsert"),
+		BatchSize: typesensePtr.Int(count),
+	}, "application/octet-stream", bytes.NewReader(data))
+	switch {
+	case err != nil:
+		return err
+	case resp.StatusCode() != http.StatusOK:
+		return dumpTypesenseError(resp.JSON400, resp.JSON404)
+	}
+
+	if err = j.importResults.track(resp.Body, data); err != nil {
+		return err
+	}
+
+	time.Sleep(j.sleepInterval)
+
+	return nil
+}
+
+// encodeMigrationDocuments transforms the documents and encodes them as JSONL, documents failing a transform are written
+// to the dead-letter file as they were read and left out. It returns the number of encoded documents.
+func encodeMigrationDocuments(docs []map[string]interface{}, transformer *documentTransformer, importResults *importResultTracker) (*bytes.Buffer, int, error) {
+	var (
+		buf   bytes.Buffer
+		count = 0
+	)
+
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+
+		original, err := json.Marshal(doc)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if transformer.isEmpty() {
+			buf.Write(original)
+			buf.WriteByte('\n')
+			count++
+			continue
 		}
 
-		time.Sleep(config.MigrationSleepInterval())
-		page++
+		n, err := transformer.encode(&buf, doc, original, importResults)
+		if err != nil {
+			return nil, 0, err
+		}
+		count += n
 	}
 
-LogSuccess:
-	log.Printf("Documents successfully migrated from %s to %s", config.MigrationSourceCollection(), config.MigrationDestinationCollection())
+	return &buf, count, nil
+}
+
+// ensureMigrationDestinationCollection creates the destination collection from the source collection schema, with the
+// overrides of migration.destination.schema applied, when it does not exist yet
+func ensureMigrationDestinationCollection(ctx context.Context, sourceClient, destinationClient typesense.APIClientInterface) error {
+	logger := log.WithFields(log.Fields{
+		"context":                    utils.DumpIncomingContext(ctx),
+		"sourceCollection":           config.MigrationSourceCollection(),
+		"destinationCollection":      config.MigrationDestinationCollection(),
+		"sourceTypesenseHost":        config.MigrationSourceTypesenseHost(),
+		"destinationTypesenseHost":   config.MigrationDestinationTypesenseHost(),
+		"sourceTypesenseAPIKey":      maskSecret(config.MigrationSourceTypesenseAPIKey()),
+		"destinationTypesenseAPIKey": maskSecret(config.MigrationDestinationTypesenseAPIKey()),
+	})
+
+	exists, err := isCollectionExists(ctx, destinationClient, config.MigrationDestinationCollection())
+	switch {
+	case err != nil:
+		logger.Error(err)
+		return err
+	case exists:
+		logger.Infof("destination collection %s already exists, it is not created", config.MigrationDestinationCollection())
+		return nil
+	}
+
+	schema, err := fetchCollectionSchema(ctx, sourceClient, config.MigrationSourceCollection())
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	schema, err = applySchemaOverrides(schema, schemaOverrides{
+		addFields:           config.MigrationDestinationSchemaAddFields(),
+		dropFields:          config.MigrationDestinationSchemaDropFields(),
+		retypeFields:        config.MigrationDestinationSchemaRetypeFields(),
+		defaultSortingField: config.MigrationDestinationSchemaDefaultSortingField(),
+	})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	logger.Infof("start creating collection %s from the schema of %s", config.MigrationDestinationCollection(), config.MigrationSourceCollection())
+	if err := createCollectionFromSchema(ctx, destinationClient, config.MigrationDestinationCollection(), schema); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	return nil
 }
 
-func buildMigrationSearchParams(page int) (searchParams *typesenseAPI.SearchCollectionParams) {
+// searchParams returns the params of a page, or of the next page after the cursor when there is one
+func (j *migrationJob) searchParams(page int, cursor *keysetCursor) (searchParams *typesenseAPI.SearchCollectionParams) {
 	searchParams = &typesenseAPI.SearchCollectionParams{
 		Q:       typesensePtr.String("*"),
-		PerPage: typesensePtr.Int(config.MigrationBatchSize()),
+		PerPage: typesensePtr.Int(j.batchSize),
 		Page:    typesensePtr.Int(page),
 	}
-	if len(config.MigrationSorter()) > 0 {
-		searchParams.SortBy = typesensePtr.String(config.MigrationSorter())
+	if len(j.sorter) > 0 {
+		searchParams.SortBy = typesensePtr.String(j.sorter)
 	}
 
-	if len(config.MigrationIncludedFields()) > 0 {
-		searchParams.IncludeFields = typesensePtr.String(strings.Join(config.MigrationIncludedFields(), ","))
+	if len(j.includedFields) > 0 {
+		searchParams.IncludeFields = typesensePtr.String(strings.Join(j.includedFields, ","))
 	}
 
-	if len(config.MigrationExcludedFields()) > 0 {
-		searchParams.ExcludeFields = typesensePtr.String(strings.Join(config.MigrationExcludedFields(), ","))
+	if len(j.excludedFields) > 0 {
+		searchParams.ExcludeFields = typesensePtr.String(strings.Join(j.excludedFields, ","))
 	}
 
-	if len(config.MigrationFilter()) > 0 {
-		searchParams.FilterBy = typesensePtr.String(config.MigrationFilter())
+	if len(j.filter) > 0 {
+		searchParams.FilterBy = typesensePtr.String(j.filter)
+	}
+
+	if cursor != nil {
+		cursor.applyTo(searchParams, j.filter)
 	}
 
 	return
 }
 
 func validateMigrationConfig() error {
+	if err := validateMigrationCommonConfig(); err != nil {
+		return err
+	}
+
+	switch {
+	case config.MigrationFilter() == "":
+		return fmt.Errorf("migration.filter cannot be empty")
+	case config.MigrationSorter() == "" && config.MigrationCursorField() == "":
+		return fmt.Errorf("migration.sorter cannot be empty without migration.cursor_field")
+	}
+
+	return nil
+}
+
+// validateMigrationCommonConfig validates the settings shared by migrate and sync
+func validateMigrationCommonConfig() error {
+	if err := validateClusterReference("migration.source", config.MigrationSourceCluster()); err != nil {
+		return err
+	}
+
+	if err := validateClusterReference("migration.destination", config.MigrationDestinationCluster()); err != nil {
+		return err
+	}
+
 	parsedURL, err := url.Parse(config.MigrationSourceTypesenseHost())
 	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
 		return fmt.Errorf("invalid source typesense host URL: %s", config.MigrationSourceTypesenseHost())
@@ -172,6 +450,14 @@ func validateMigrationConfig() error {
 		return fmt.Errorf("invalid destination typesense host URL: %s", config.MigrationDestinationTypesenseHost())
 	}
 
+	if err := validateTLSSettings("migration.source", config.MigrationSourceCluster(), config.MigrationSourceTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
+	if err := validateTLSSettings("migration.destination", config.MigrationDestinationCluster(), config.MigrationDestinationTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
 	switch {
 	case config.MigrationSourceTypesenseAPIKey() == "":
 		return fmt.Errorf("migration.source.typesense.api_key cannot be empty")
@@ -181,12 +467,22 @@ func validateMigrationConfig() error {
 		return fmt.Errorf("migration.source.collection cannot be empty")
 	case config.MigrationDestinationCollection() == "":
 		return fmt.Errorf("migration.destination.collection cannot be empty")
-	case config.MigrationFilter() == "":
-		return fmt.Errorf("migration.filter cannot be empty")
-	case config.MigrationSorter() == "":
-		return fmt.Errorf("migration.sorter cannot be empty")
 	case config.MigrationBatchSize() <= 0:
 		return fmt.Errorf("migration.batch_size must be a positive integer")
+	case config.MigrationWorkers() <= 0:
+		return fmt.Errorf("migration.workers must be a positive integer")
+	}
+
+	if err := validateCursorField("migration.cursor_field", config.MigrationCursorField(), config.MigrationIncludedFields(), config.MigrationExcludedFields()); err != nil {
+		return err
+	}
+
+	if _, err := newDocumentTransforms(config.MigrationTransforms()); err != nil {
+		return fmt.Errorf("migration.transforms: %w", err)
+	}
+
+	if _, err := newDocumentTransformer(nil, config.MigrationTransformScript()); err != nil {
+		return fmt.Errorf("migration.transform_script: %w", err)
 	}
 
 	return nil
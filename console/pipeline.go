@@ -0,0 +1,149 @@
+package console
+
+import (
+	"context"
+	"sync"
+)
+
+// importJob is a batch of documents emitted by the reader of an import pipeline. A worker prepares it, returning the
+// JSONL to import and its number of documents, and imports it. Once every earlier job is imported, commit is called,
+// so that a checkpoint never covers a batch still in flight.
+type importJob struct {
+	seq     int
+	prepare func(transformer *documentTransformer) ([]byte, int, error)
+	commit  func() error
+}
+
+type importJobResult struct {
+	seq    int
+	commit func() error
+	err    error
+}
+
+// importPipeline reads batches in a single goroutine, hands them to a fixed number of workers through a bounded
+// channel, which blocks the reader while every worker is busy, and commits them in the order they were read. Each
+// worker owns a transformer since the script runtime is not safe for concurrent use.
+type importPipeline struct {
+	transformers []*documentTransformer
+	importBatch  func(ctx context.Context, data []byte, count int) error
+}
+
+func newImportPipeline(workers int, newTransformer func() (*documentTransformer, error), importBatch func(ctx context.Context, data []byte, count int) error) (*importPipeline, error) {
+	transformers := make([]*documentTransformer, 0, workers)
+	for i := 0; i < workers; i++ {
+		transformer, err := newTransformer()
+		if err != nil {
+			return nil, err
+		}
+		transformers = append(transformers, transformer)
+	}
+
+	return &importPipeline{
+		transformers: transformers,
+		importBatch:  importBatch,
+	}, nil
+}
+
+// run calls read with a function emitting the jobs, numbered from 0, and returns the first error of the reader, a
+// worker or a commit. Jobs still queued after an error are dropped.
+func (p *importPipeline) run(ctx context.Context, read func(ctx context.Context, emit func(job importJob) error) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		jobs    = make(chan importJob, len(p.transformers))
+		results = make(chan importJobResult, len(p.transformers))
+		readErr = make(chan error, 1)
+		wg      sync.WaitGroup
+	)
+
+	go func() {
+		defer close(jobs)
+		readErr <- read(ctx, func(job importJob) error {
+			select {
+			case jobs <- job:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	for _, transformer := range p.transformers {
+		wg.Add(1)
+		go func(transformer *documentTransformer) {
+			defer wg.Done()
+			for job := range jobs {
+				results <- importJobResult{seq: job.seq, commit: job.commit, err: p.process(ctx, transformer, job)}
+			}
+		}(transformer)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	err := commitInOrder(results, cancel)
+	if err != nil {
+		return err
+	}
+
+	return <-readErr
+}
+
+func (p *importPipeline) process(ctx context.Context, transformer *documentTransformer, job importJob) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, count, err := job.prepare(transformer)
+	if err != nil {
+		return err
+	}
+
+	return p.importBatch(ctx, data, count)
+}
+
+// commitInOrder commits the jobs by sequence number as soon as every earlier one is done, and cancels the pipeline
+// on the first error. It drains the results until the workers are done.
+func commitInOrder(results <-chan importJobResult, cancel context.CancelFunc) error {
+	var (
+		pending  = make(map[int]importJobResult)
+		next     = 0
+		firstErr error
+	)
+
+	for result := range results {
+		if firstErr != nil {
+			continue
+		}
+
+		if result.err != nil {
+			firstErr = result.err
+			cancel()
+			continue
+		}
+
+		pending[result.seq] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if ready.commit == nil {
+				continue
+			}
+			if err := ready.commit(); err != nil {
+				firstErr = err
+				cancel()
+				break
+			}
+		}
+	}
+
+	return firstErr
+}
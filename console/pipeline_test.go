@@ -0,0 +1,72 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportPipeline(t *testing.T) {
+	newTransformer := func() (*documentTransformer, error) {
+		return newDocumentTransformer(nil, "")
+	}
+
+	readJobs := func(n int, committed *[]int) func(ctx context.Context, emit func(job importJob) error) error {
+		return func(_ context.Context, emit func(job importJob) error) error {
+			for i := 0; i < n; i++ {
+				seq := i
+				err := emit(importJob{
+					seq: seq,
+					prepare: func(_ *documentTransformer) ([]byte, int, error) {
+						return []byte(fmt.Sprint(seq)), 1, nil
+					},
+					commit: func() error {
+						*committed = append(*committed, seq)
+						return nil
+					},
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	t.Run("commit in order while importing out of order", func(t *testing.T) {
+		pipeline, err := newImportPipeline(4, newTransformer, func(_ context.Context, data []byte, _ int) error {
+			if string(data) == "0" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		var committed []int
+		require.NoError(t, pipeline.run(context.Background(), readJobs(20, &committed)))
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, committed)
+	})
+
+	t.Run("stop committing at the first failed batch", func(t *testing.T) {
+		importErr := errors.New("import failed")
+		pipeline, err := newImportPipeline(2, newTransformer, func(_ context.Context, data []byte, _ int) error {
+			if string(data) == "3" {
+				return importErr
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		var committed []int
+		assert.ErrorIs(t, pipeline.run(context.Background(), readJobs(100, &committed)), importErr)
+		assert.LessOrEqual(t, len(committed), 3)
+		for i, seq := range committed {
+			assert.Equal(t, i, seq)
+		}
+	})
+}
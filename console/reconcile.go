@@ -0,0 +1,193 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"typesense-migration-tools/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/typesense/typesense-go/v2/typesense"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
+)
+
+// reconciliation deletes the destination documents whose id is not in the source collection anymore, which the
+// timestamp polls of sync cannot see
+type reconciliation struct {
+	sourceClient          typesense.APIClientInterface
+	destinationClient     typesense.APIClientInterface
+	sourceCollection      string
+	destinationCollection string
+	filter                string
+	batchSize             int
+	sleepInterval         time.Duration
+	maxDeletions          int
+	dryRun                bool
+}
+
+// run returns the ids of the documents only found in the destination, which are deleted unless dryRun is set. The
+// destination ids are read before the source ones, so that a document created in between is never taken for a
+// deleted one, and every candidate is looked up again in the source before being deleted.
+func (r *reconciliation) run(ctx context.Context) ([]string, error) {
+	extra := make(map[string]bool)
+	err := forEachIDPage(ctx, r.destinationClient, r.destinationCollection, "", r.batchSize, func(ids []string) {
+		for _, id := range ids {
+			extra[id] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = forEachIDPage(ctx, r.sourceClient, r.sourceCollection, r.filter, r.batchSize, func(ids []string) {
+		for _, id := range ids {
+			delete(extra, id)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := r.confirmMissing(ctx, sortedIDs(extra))
+	switch {
+	case err != nil:
+		return nil, err
+	case len(ids) == 0 || r.dryRun:
+		return ids, nil
+	case len(ids) > r.maxDeletions:
+		return ids, fmt.Errorf("%d documents of %s are missing from %s, more than the %d allowed by migration.sync.reconcile.max_deletions",
+			len(ids), r.destinationCollection, r.sourceCollection, r.maxDeletions)
+	}
+
+	return ids, r.deleteDocuments(ctx, ids)
+}
+
+// validateReconcileConfig refuses to reconcile documents that went through transforms: a transform script may fan a
+// source document out or rename its id, and reconciling would then delete every derived document of the destination
+func validateReconcileConfig() error {
+	if config.MigrationSyncReconcileInterval() <= 0 {
+		return nil
+	}
+
+	if len(config.MigrationTransforms()) > 0 || config.MigrationTransformScript() != "" {
+		return fmt.Errorf("migration.sync.reconcile.interval cannot be set along with migration.transforms or migration.transform_script, " +
+			"the destination ids may not match the source ones")
+	}
+
+	return nil
+}
+
+// confirmMissing keeps the ids still not found in the source, documents may have been missed while paging through it
+func (r *reconciliation) confirmMissing(ctx context.Context, candidates []string) ([]string, error) {
+	var missing []string
+	for _, batch := range chunkIDs(candidates, r.batchSize) {
+		found := make(map[string]bool)
+		err := forEachIDPage(ctx, r.sourceClient, r.sourceCollection, joinFilters(r.filter, idFilter(batch)), r.batchSize, func(ids []string) {
+			for _, id := range ids {
+				found[id] = true
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range batch {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+func (r *reconciliation) deleteDocuments(ctx context.Context, ids []string) error {
+	for _, batch := range chunkIDs(ids, r.batchSize) {
+		log.Printf("Deleting %d documents missing from %s: %q", len(batch), r.sourceCollection, batch)
+
+		resp, err := r.destinationClient.DeleteDocumentsWithResponse(ctx, r.destinationCollection, &typesenseAPI.DeleteDocumentsParams{
+			BatchSize: typesensePtr.Int(r.batchSize),
+			FilterBy:  typesensePtr.String(idFilter(batch)),
+		})
+		switch {
+		case err != nil:
+			return err
+		case resp.StatusCode() != http.StatusOK:
+			return dumpTypesenseError(resp.JSON404)
+		}
+
+		time.Sleep(r.sleepInterval)
+	}
+
+	return nil
+}
+
+// forEachIDPage pages through the ids of the documents matching filter, only fetching the id field
+func forEachIDPage(ctx context.Context, client typesense.APIClientInterface, collection, filter string, batchSize int, fn func(ids []string)) error {
+	for page := 1; ; page++ {
+		searchParams := &typesenseAPI.SearchCollectionParams{
+			Q:             typesensePtr.String("*"),
+			PerPage:       typesensePtr.Int(batchSize),
+			Page:          typesensePtr.Int(page),
+			IncludeFields: typesensePtr.String("id"),
+		}
+		if filter != "" {
+			searchParams.FilterBy = typesensePtr.String(filter)
+		}
+
+		searchResult, err := client.SearchCollectionWithResponse(ctx, collection, searchParams)
+		switch {
+		case err != nil:
+			return err
+		case isTypesenseErrorResponse(searchResult):
+			return dumpTypesenseSearchResponseError(searchResult)
+		case len(*searchResult.JSON200.Hits) <= 0:
+			return nil
+		}
+
+		ids := make([]string, 0, len(*searchResult.JSON200.Hits))
+		for _, item := range *searchResult.JSON200.Hits {
+			if id, ok := (*item.Document)["id"].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		fn(ids)
+	}
+}
+
+// idFilter matches the given ids, each one is wrapped in backticks in case it holds a comma or a bracket
+func idFilter(ids []string) string {
+	quoted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		quoted = append(quoted, "`"+id+"`")
+	}
+
+	return fmt.Sprintf("id:=[%s]", strings.Join(quoted, ","))
+}
+
+func chunkIDs(ids []string, size int) [][]string {
+	var chunks [][]string
+	for len(ids) > size {
+		chunks = append(chunks, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+
+	return chunks
+}
+
+func sortedIDs[V any](set map[string]V) []string {
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
@@ -0,0 +1,55 @@
+package console
+
+import (
+	"testing"
+	"time"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileHelpers(t *testing.T) {
+	t.Run("quote the ids of the filter", func(t *testing.T) {
+		assert.Equal(t, "id:=[`1`,`a,b`]", idFilter([]string{"1", "a,b"}))
+	})
+
+	t.Run("chunk ids by batch size", func(t *testing.T) {
+		assert.Equal(t, [][]string{{"1", "2"}, {"3"}}, chunkIDs([]string{"1", "2", "3"}, 2))
+		assert.Equal(t, [][]string{{"1", "2"}}, chunkIDs([]string{"1", "2"}, 2))
+		assert.Nil(t, chunkIDs(nil, 2))
+	})
+}
+
+func TestValidateReconcileConfig(t *testing.T) {
+	t.Run("reconcile untransformed documents", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		viper.Set("migration.sync.reconcile.interval", time.Hour)
+
+		assert.NoError(t, validateReconcileConfig())
+	})
+
+	t.Run("refuse to reconcile documents going through transforms", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		viper.Set("migration.sync.reconcile.interval", time.Hour)
+		viper.Set("migration.transforms", []config.Transform{{Type: config.TransformRename, Field: "id", To: "source_id"}})
+
+		assert.EqualError(t, validateReconcileConfig(), "migration.sync.reconcile.interval cannot be set along with "+
+			"migration.transforms or migration.transform_script, the destination ids may not match the source ones")
+	})
+
+	t.Run("refuse to reconcile documents going through a transform script", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		viper.Set("migration.sync.reconcile.interval", time.Hour)
+		viper.Set("migration.transform_script", "fan_out.js")
+
+		assert.Error(t, validateReconcileConfig())
+	})
+
+	t.Run("sync transformed documents without reconciling", func(t *testing.T) {
+		t.Cleanup(viper.Reset)
+		viper.Set("migration.transform_script", "fan_out.js")
+
+		assert.NoError(t, validateReconcileConfig())
+	})
+}
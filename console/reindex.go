@@ -0,0 +1,343 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"typesense-migration-tools/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+)
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "reindex the collection behind a typesense alias",
+	Long:  `This subcommand copy the collection behind an alias into a new versioned collection, then swap the alias to it`,
+	Run:   runReindex,
+}
+
+// collectionVersionPattern matches versioned collection names such as articles_v7
+var collectionVersionPattern = regexp.MustCompile(`^(.+)_v(\d+)$`)
+
+func init() {
+	addTypesenseFlags(reindexCmd, "", "reindex")
+	addStringFlag(reindexCmd, "alias", "reindex.alias")
+	addStringFlag(reindexCmd, "collection", "reindex.collection")
+	addStringFlag(reindexCmd, "schema-file", "reindex.schema_file")
+	addStringFlag(reindexCmd, "sorter", "reindex.sorter")
+	addStringFlag(reindexCmd, "cursor-field", "reindex.cursor_field")
+	addStringFlag(reindexCmd, "transform-script", "reindex.transform_script")
+	addIntFlag(reindexCmd, "batch-size", "reindex.batch_size")
+	addIntFlag(reindexCmd, "workers", "reindex.workers")
+	addDurationFlag(reindexCmd, "sleep-interval", "reindex.sleep_interval")
+	RootCmd.AddCommand(reindexCmd)
+}
+
+func runReindex(_ *cobra.Command, _ []string) {
+	err := validateReindexConfig()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	ctx := context.TODO()
+	tsClient, err := newTypesenseClient(config.ReindexTypesenseConnection())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	current, err := fetchAliasCollection(ctx, tsClient, config.ReindexAlias())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	next := config.ReindexCollection()
+	if next == "" {
+		next = nextCollectionVersion(current)
+	}
+
+	schemaSource := fmt.Sprintf("copied from %s", current)
+	if config.ReindexSchemaFile() != "" {
+		schemaSource = config.ReindexSchemaFile()
+	}
+
+	fmt.Printf("Typesense Host: %s\n", config.ReindexTypesenseHost())
+	fmt.Printf("Typesense API Key: %s\n", maskSecret(config.ReindexTypesenseAPIKey()))
+	fmt.Printf("Alias: %s\n", config.ReindexAlias())
+	fmt.Printf("Current Collection Name: %s\n", current)
+	fmt.Printf("New Collection Name: %s\n", next)
+	fmt.Printf("Schema: %s\n", schemaSource)
+	fmt.Printf("Sorter: %s\n", config.ReindexSorter())
+	fmt.Printf("Cursor Field: %s\n", config.ReindexCursorField())
+	fmt.Printf("Batch Size: %d\n", config.ReindexBatchSize())
+	fmt.Printf("Workers: %d\n", config.ReindexWorkers())
+	fmt.Printf("Transforms: %d\n", len(config.ReindexTransforms()))
+	fmt.Printf("Transform Script: %s\n", config.ReindexTransformScript())
+	fmt.Printf("Delete Old Collection: %t\n", config.ReindexDeleteOldCollection())
+	switch {
+	case config.ReindexCursorField() == "":
+		log.Warn("reindex.cursor_field is not set, documents written to the collection while it is copied may be skipped or missed")
+	case config.ReindexSorter() != "":
+		log.Warn("reindex.sorter is ignored while copying, documents are sorted on reindex.cursor_field")
+	}
+	if !confirmProceed(os.Stdout, os.Stdin) {
+		log.Println("Reindex operation cancelled.")
+		return
+	}
+
+	importResults := newImportResultTracker(config.ReindexRejectedFilePath(), config.ReindexMaxFailureRatio())
+	defer importResults.Close()
+
+	if err := reindexCollection(ctx, tsClient, current, next, importResults); err != nil {
+		log.Error(err)
+		log.Errorf("alias %s still points to %s, collection %s is left as is for inspection", config.ReindexAlias(), current, next)
+		return
+	}
+
+	if err := swapAlias(ctx, tsClient, config.ReindexAlias(), next); err != nil {
+		log.Error(err)
+		return
+	}
+	log.Printf("Alias %s successfully swapped from %s to %s", config.ReindexAlias(), current, next)
+
+	if !config.ReindexDeleteOldCollection() {
+		return
+	}
+
+	deletion := &collectionDeletion{
+		client:        tsClient,
+		collection:    current,
+		batchSize:     config.ReindexBatchSize(),
+		sorter:        config.ReindexSorter(),
+		sleepInterval: config.ReindexSleepInterval(),
+	}
+	if err := deletion.run(ctx); err != nil {
+		return
+	}
+
+	log.Printf("Collection %s successfully deleted", current)
+}
+
+// reindexCollection creates the new collection, migrates every document of the current one into it and checks that
+// both hold the same number of documents. Nothing is written to the new collection after this returns, so the alias
+// should be swapped right away.
+func reindexCollection(ctx context.Context, client typesense.APIClientInterface, current, next string, importResults *importResultTracker) error {
+	if err := createReindexCollection(ctx, client, current, next); err != nil {
+		return err
+	}
+
+	job := &migrationJob{
+		sourceClient:               client,
+		destinationClient:          client,
+		sourceCollection:           current,
+		destinationCollection:      next,
+		sourceTypesenseHost:        config.ReindexTypesenseHost(),
+		destinationTypesenseHost:   config.ReindexTypesenseHost(),
+		sourceTypesenseAPIKey:      config.ReindexTypesenseAPIKey(),
+		destinationTypesenseAPIKey: config.ReindexTypesenseAPIKey(),
+		sorter:                     config.ReindexSorter(),
+		batchSize:                  config.ReindexBatchSize(),
+		sleepInterval:              config.ReindexSleepInterval(),
+		workers:                    config.ReindexWorkers(),
+		transforms:                 config.ReindexTransforms(),
+		transformScript:            config.ReindexTransformScript(),
+		importResults:              importResults,
+	}
+	if err := migrateReindexDocuments(ctx, job, config.ReindexCursorField()); err != nil {
+		return err
+	}
+
+	log.Printf("Documents successfully migrated from %s to %s", current, next)
+
+	return verifyReindexCount(ctx, client, current, next)
+}
+
+// migrateReindexDocuments copies the documents by page numbers without a cursor field. With one, it pages with a
+// cursor on the field, then runs a second copy from the highest value seen before the first one started, which catches
+// up on the documents written meanwhile, including the ones written after the first copy read its last page.
+func migrateReindexDocuments(ctx context.Context, job *migrationJob, cursorField string) error {
+	if cursorField == "" {
+		return job.run(ctx)
+	}
+
+	watermark, err := copyFromWatermark(ctx, job, cursorField, "")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Catching up on the documents of %s written since the copy started, with %s:>=%s", job.sourceCollection, cursorField, watermark)
+
+	_, err = copyFromWatermark(ctx, job, cursorField, watermark)
+
+	return err
+}
+
+// createReindexCollection creates the new collection from reindex.schema_file, or from a copy of the current schema
+func createReindexCollection(ctx context.Context, client typesense.APIClientInterface, current, next string) error {
+	exists, err := isCollectionExists(ctx, client, next)
+	switch {
+	case err != nil:
+		return err
+	case exists:
+		return fmt.Errorf("collection %s already exists, set reindex.collection to another name", next)
+	}
+
+	var schema map[string]any
+	if config.ReindexSchemaFile() != "" {
+		schema, err = readSchemaJSONFile(config.ReindexSchemaFile())
+	} else {
+		schema, err = fetchCollectionSchema(ctx, client, current)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Creating collection %s\n", next)
+
+	return createCollectionFromSchema(ctx, client, next, schema)
+}
+
+// verifyReindexCount fails when the new collection holds a different number of documents than the current one, unless
+// reindex.allow_count_mismatch is set
+func verifyReindexCount(ctx context.Context, client typesense.APIClientInterface, current, next string) error {
+	currentCount, err := collectionDocumentCount(ctx, client, current)
+	if err != nil {
+		return err
+	}
+
+	nextCount, err := collectionDocumentCount(ctx, client, next)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case currentCount == nextCount:
+		log.Printf("Document counts match: %d documents in %s and %s", currentCount, current, next)
+		return nil
+	case config.ReindexAllowCountMismatch():
+		log.Warnf("document counts differ: %d documents in %s, %d in %s", currentCount, current, nextCount, next)
+		return nil
+	}
+
+	return fmt.Errorf("document counts differ: %d documents in %s, %d in %s", currentCount, current, nextCount, next)
+}
+
+func collectionDocumentCount(ctx context.Context, client typesense.APIClientInterface, collection string) (int64, error) {
+	resp, err := client.GetCollectionWithResponse(ctx, collection)
+	switch {
+	case err != nil:
+		return 0, err
+	case resp.StatusCode() != http.StatusOK || resp.JSON200 == nil:
+		return 0, dumpTypesenseError(resp.JSON404)
+	case resp.JSON200.NumDocuments == nil:
+		return 0, nil
+	}
+
+	return *resp.JSON200.NumDocuments, nil
+}
+
+// fetchAliasCollection returns the name of the collection the alias points to
+func fetchAliasCollection(ctx context.Context, client typesense.APIClientInterface, alias string) (string, error) {
+	resp, err := client.GetAliasWithResponse(ctx, alias)
+	switch {
+	case err != nil:
+		return "", err
+	case resp.StatusCode() == http.StatusNotFound:
+		return "", fmt.Errorf("alias %s does not exist", alias)
+	case resp.StatusCode() != http.StatusOK || resp.JSON200 == nil:
+		return "", dumpTypesenseError(string(resp.Body))
+	}
+
+	return resp.JSON200.CollectionName, nil
+}
+
+// swapAlias points the alias to the collection, typesense switches the reads over atomically
+func swapAlias(ctx context.Context, client typesense.APIClientInterface, alias, collection string) error {
+	resp, err := client.UpsertAliasWithResponse(ctx, alias, typesenseAPI.CollectionAliasSchema{CollectionName: collection})
+	switch {
+	case err != nil:
+		return err
+	case resp.StatusCode() != http.StatusOK:
+		return dumpTypesenseError(resp.JSON400, resp.JSON404)
+	}
+
+	return nil
+}
+
+// nextCollectionVersion bumps the _vN suffix of a collection name, a name without suffix being the first version
+func nextCollectionVersion(collection string) string {
+	matches := collectionVersionPattern.FindStringSubmatch(collection)
+	if matches == nil {
+		return collection + "_v2"
+	}
+
+	version, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return collection + "_v2"
+	}
+
+	return fmt.Sprintf("%s_v%d", matches[1], version+1)
+}
+
+// readSchemaJSONFile reads a collection schema in the format of the retrieve collection API, its name is ignored
+func readSchemaJSONFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+
+	return schema, nil
+}
+
+func validateReindexConfig() error {
+	if err := validateClusterReference("reindex", config.ReindexCluster()); err != nil {
+		return err
+	}
+
+	parsedURL, err := url.Parse(config.ReindexTypesenseHost())
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid typesense host URL: %s", config.ReindexTypesenseHost())
+	}
+
+	if err := validateTLSSettings("reindex", config.ReindexCluster(), config.ReindexTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
+	switch {
+	case config.ReindexTypesenseAPIKey() == "":
+		return fmt.Errorf("reindex.typesense.api_key cannot be empty")
+	case config.ReindexAlias() == "":
+		return fmt.Errorf("reindex.alias cannot be empty")
+	case config.ReindexCollection() == config.ReindexAlias() && config.ReindexCollection() != "":
+		return fmt.Errorf("reindex.collection cannot be named after the alias")
+	case config.ReindexBatchSize() <= 0:
+		return fmt.Errorf("reindex.batch_size must be a positive integer")
+	case config.ReindexWorkers() <= 0:
+		return fmt.Errorf("reindex.workers must be a positive integer")
+	}
+
+	if _, err := newDocumentTransforms(config.ReindexTransforms()); err != nil {
+		return fmt.Errorf("reindex.transforms: %w", err)
+	}
+
+	if _, err := newDocumentTransformer(nil, config.ReindexTransformScript()); err != nil {
+		return fmt.Errorf("reindex.transform_script: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package console
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"typesense-migration-tools/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextCollectionVersion(t *testing.T) {
+	assert.Equal(t, "articles_v8", nextCollectionVersion("articles_v7"))
+	assert.Equal(t, "articles_v10", nextCollectionVersion("articles_v9"))
+	assert.Equal(t, "articles_v2", nextCollectionVersion("articles"))
+	assert.Equal(t, "articles_vip_v2", nextCollectionVersion("articles_vip"))
+	assert.Equal(t, "my_v1_articles_v2", nextCollectionVersion("my_v1_articles"))
+}
+
+func TestMigrateReindexDocumentsCatchesUpOnWrites(t *testing.T) {
+	fake := &fakeSyncServer{
+		docs: map[string]int64{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6},
+		afterSearch: func(s *fakeSyncServer) {
+			switch s.searched {
+			// a is updated while the pages are read
+			case 1:
+				s.docs["a"] = 7
+			// g is written once the copy read its last, empty page, right before the alias would be swapped
+			case 5:
+				s.docs["g"] = 8
+			}
+		},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := newTypesenseClient(config.TypesenseConnection{Host: server.URL, APIKey: "key", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	job := &migrationJob{
+		sourceClient:          client,
+		destinationClient:     client,
+		sourceCollection:      "articles_v1",
+		destinationCollection: "articles_v2",
+		batchSize:             2,
+		workers:               1,
+		importResults:         newImportResultTracker(filepath.Join(t.TempDir(), "rejected.jsonl"), 0),
+	}
+
+	require.NoError(t, migrateReindexDocuments(context.Background(), job, "updated_at"))
+
+	assert.Subset(t, fake.imported, []string{"a", "b", "c", "d", "e", "f", "g"})
+}
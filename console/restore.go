@@ -4,11 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 	"typesense-migration-tools/config"
 
@@ -28,63 +30,127 @@ var restoreCmd = &cobra.Command{
 }
 
 func init() {
+	restoreCmd.Flags().Bool("resume", false, "continue an interrupted restore from the state in restore.folder_path")
+	addTypesenseFlags(restoreCmd, "", "restore")
+	addStringFlag(restoreCmd, "collection", "restore.collection")
+	addStringFlag(restoreCmd, "folder-path", "restore.folder_path")
+	addStringFlag(restoreCmd, "transform-script", "restore.transform_script")
+	addIntFlag(restoreCmd, "batch-size", "restore.batch_size")
+	addIntFlag(restoreCmd, "workers", "restore.workers")
+	addDurationFlag(restoreCmd, "sleep-interval", "restore.sleep_interval")
 	RootCmd.AddCommand(restoreCmd)
 }
 
-func runRestore(_ *cobra.Command, _ []string) {
+func runRestore(cmd *cobra.Command, _ []string) {
 	err := validateRestoreConfig()
 	if err != nil {
 		log.Error(err)
 		return
 	}
 
+	resume, _ := cmd.Flags().GetBool("resume")
+
+	ctx := context.TODO()
+	st, err := newStorage(ctx, config.RestoreFolderPath())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if resume && !isResumableStorage(st) {
+		log.Errorf("restore from %s can not be resumed", st)
+		return
+	}
+
 	fmt.Printf("Typesense Host: %s\n", config.RestoreTypesenseHost())
-	fmt.Printf("Typesense API Key: %s\n", config.RestoreTypesenseAPIKey())
+	fmt.Printf("Typesense API Key: %s\n", maskSecret(config.RestoreTypesenseAPIKey()))
 	fmt.Printf("Collection Name: %s\n", config.RestoreCollection())
 	fmt.Printf("Folder Path: %s\n", config.RestoreFolderPath())
+	fmt.Printf("Files: %s\n", restoreFileSelectionDescription())
 	fmt.Printf("Batch Size: %d\n", config.RestoreBatchSize())
-	fmt.Print("Do you want to proceed with these config? (yes/no): ")
+	fmt.Printf("Workers: %d\n", config.RestoreWorkers())
+	fmt.Printf("Transform Script: %s\n", config.RestoreTransformScript())
+	fmt.Printf("Resume: %t\n", resume)
 
-	var confirmation string
-	fmt.Scanln(&confirmation)
-	if confirmation != "yes" {
+	proceed, err := confirmProceedWithStorage(st)
+	switch {
+	case err != nil:
+		log.Error(err)
+		return
+	case !proceed:
 		log.Println("Export operation cancelled.")
 		return
 	}
 
-	files, err := filepath.Glob(filepath.Join(config.RestoreFolderPath(), "*.jsonl"))
+	files, err := findRestoreFiles(st)
 	if err != nil {
 		log.Error(err)
 		return
 	}
 
-	if len(files) == 0 {
-		log.Error(fmt.Errorf("no backup files found in folder: %s", config.RestoreFolderPath()))
+	state, err := loadRestoreState(st, resume)
+	if err != nil {
+		log.Error(err)
 		return
 	}
 
-	var (
-		ctx      = context.TODO()
-		tsClient = newTypesenseClient(config.RestoreTypesenseHost(), config.RestoreTypesenseAPIKey())
-	)
+	tsClient, err := newTypesenseClient(config.RestoreTypesenseConnection())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if err := ensureRestoreCollection(ctx, st, tsClient); err != nil {
+		log.Error(err)
+		return
+	}
+
+	importResults := newImportResultTracker(config.RestoreRejectedFilePath(), config.RestoreMaxFailureRatio())
+	defer importResults.Close()
+
+	pipeline, err := newImportPipeline(config.RestoreWorkers(), newRestoreTransformer, func(ctx context.Context, data []byte, _ int) error {
+		return sendBatch(ctx, tsClient, data, importResults)
+	})
+	if err != nil {
+		log.Error(err)
+		return
+	}
 
 	for _, file := range files {
+		if state.isCompleted(file) {
+			log.Printf("Skipping already restored file: %s\n", file)
+			continue
+		}
+
 		log.Printf("Restoring from file: %s\n", file)
-		if err := restoreFromFile(ctx, tsClient, file); err != nil {
+		if err := restoreFromFile(ctx, st, pipeline, file, state, importResults); err != nil {
 			log.Error(fmt.Errorf("error restoring file %s: %w", file, err))
 			return
 		}
 	}
 
+	if err := state.remove(); err != nil {
+		log.Error(err)
+		return
+	}
+
 	log.Printf("Documents successfully imported to %s", config.RestoreCollection())
 }
 
 func validateRestoreConfig() error {
+	if err := validateClusterReference("restore", config.RestoreCluster()); err != nil {
+		return err
+	}
+
 	parsedURL, err := url.Parse(config.RestoreTypesenseHost())
 	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
 		return fmt.Errorf("invalid typesense host URL: %s", config.RestoreTypesenseHost())
 	}
 
+	if err := validateTLSSettings("restore", config.RestoreCluster(), config.RestoreTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
 	switch {
 	case config.RestoreTypesenseAPIKey() == "":
 		return fmt.Errorf("restore.typesense.api_key cannot be empty")
@@ -94,35 +160,220 @@ func validateRestoreConfig() error {
 		return fmt.Errorf("restore.folder_path cannot be empty")
 	case config.RestoreBatchSize() <= 0:
 		return fmt.Errorf("restore.batch_size must be a positive integer")
+	case config.RestoreWorkers() <= 0:
+		return fmt.Errorf("restore.workers must be a positive integer")
+	case config.RestoreMaxLineSize() <= 0:
+		return fmt.Errorf("restore.max_line_size must be a positive size")
+	case len(config.RestoreFiles()) > 0 && len(config.RestoreInclude())+len(config.RestoreExclude()) > 0:
+		return fmt.Errorf("restore.files cannot be combined with restore.include or restore.exclude")
+	}
+
+	if err := validatePatterns("restore.include", config.RestoreInclude()); err != nil {
+		return err
+	}
+
+	if err := validatePatterns("restore.exclude", config.RestoreExclude()); err != nil {
+		return err
+	}
+
+	if _, err := newDocumentTransformer(nil, config.RestoreTransformScript()); err != nil {
+		return fmt.Errorf("restore.transform_script: %w", err)
+	}
+
+	return nil
+}
+
+// loadRestoreState returns the state to continue from when resuming, or a fresh one otherwise
+func loadRestoreState(st storage, resume bool) (*restoreState, error) {
+	state, err := readRestoreState(st)
+	switch {
+	case err != nil:
+		return nil, err
+	case !resume && state != nil:
+		log.Warnf("found %s from a previous run, starting over since --resume is not set", restoreStateFileName)
+		return newRestoreState(st), nil
+	case !resume:
+		return newRestoreState(st), nil
+	case state == nil:
+		return nil, fmt.Errorf("no %s found in %s to resume from", restoreStateFileName, st)
+	case state.Collection != config.RestoreCollection():
+		return nil, fmt.Errorf("restore state collection %s does not match restore.collection %s", state.Collection, config.RestoreCollection())
+	}
+
+	log.Printf("Resuming restore with %d files already restored", len(state.CompletedFiles))
+
+	return state, nil
+}
+
+func restoreFileSelectionDescription() string {
+	if len(config.RestoreFiles()) > 0 {
+		return strings.Join(config.RestoreFiles(), ",")
+	}
+
+	var parts []string
+	if len(config.RestoreInclude()) > 0 {
+		parts = append(parts, "include "+strings.Join(config.RestoreInclude(), ","))
+	}
+	if len(config.RestoreExclude()) > 0 {
+		parts = append(parts, "exclude "+strings.Join(config.RestoreExclude(), ","))
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// findRestoreFiles returns the backup files selected by restore.files, restore.include and restore.exclude, verified
+// against the manifest and in the order they are restored
+func findRestoreFiles(st storage) ([]string, error) {
+	found, err := findBackupFiles(st)
+	if err != nil {
+		return nil, err
+	}
+
+	selection := newRestoreFileSelection()
+	files, err := selection.apply(found)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(files) == 0 && len(found) > 0:
+		return nil, fmt.Errorf("none of the %d backup files in %s is selected by restore.include and restore.exclude", len(found), st)
+	case len(files) == 0:
+		return nil, fmt.Errorf("no backup files found in %s", st)
+	}
+
+	manifest, err := readManifestFile(st)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyRestoreFiles(st, manifest, selection, files); err != nil {
+		return nil, err
+	}
+
+	return selection.order(files, manifest), nil
+}
+
+// verifyRestoreFiles compares the selected backup files against the manifest, mismatches are only logged when restore.ignore_checksum_mismatch is enabled
+func verifyRestoreFiles(st storage, manifest *backupManifest, selection *restoreFileSelection, files []string) error {
+	if manifest == nil {
+		log.Warnf("no %s found in %s, the backup files cannot be verified", manifestFileName, st)
+		return nil
+	}
+
+	manifest = selection.manifestSubset(manifest)
+	errs := verifyBackupFiles(st, manifest, files)
+	if len(errs) == 0 {
+		log.Printf("All %d backup files match %s", len(manifest.Files), manifestFileName)
+		return nil
+	}
+
+	if config.RestoreIgnoreChecksumMismatch() {
+		for _, err := range errs {
+			log.Warn(err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("backup files do not match %s: %w", manifestFileName, errors.Join(errs...))
+}
+
+// ensureRestoreCollection creates the target collection from the backed up schema when it does not exist yet
+func ensureRestoreCollection(ctx context.Context, st storage, client typesense.APIClientInterface) error {
+	logger := log.WithFields(log.Fields{
+		"context":         utils.DumpIncomingContext(ctx),
+		"collection":      config.RestoreCollection(),
+		"typesenseHost":   config.RestoreTypesenseHost(),
+		"typesenseAPIKey": maskSecret(config.RestoreTypesenseAPIKey()),
+		"folderPath":      config.RestoreFolderPath(),
+	})
+
+	exists, err := isCollectionExists(ctx, client, config.RestoreCollection())
+	switch {
+	case err != nil:
+		logger.Error(err)
+		return err
+	case exists:
+		return nil
+	}
+
+	schema, err := readSchemaFile(st)
+	switch {
+	case err != nil:
+		logger.Error(err)
+		return err
+	case schema == nil:
+		return fmt.Errorf("collection %s does not exist and no %s found in %s", config.RestoreCollection(), schemaFileName, st)
+	}
+
+	logger.Infof("start creating collection %s from %s", config.RestoreCollection(), schemaFileName)
+	if err := createCollectionFromSchema(ctx, client, config.RestoreCollection(), schema); err != nil {
+		logger.Error(err)
+		return err
 	}
 
 	return nil
 }
 
-func restoreFromFile(ctx context.Context, client typesense.APIClientInterface, filePath string) error {
+// restoreFromFile imports the lines of a backup file in batches, recording each one in the restore state once every
+// earlier batch of the file is imported
+func restoreFromFile(ctx context.Context, st storage, pipeline *importPipeline, fileName string, state *restoreState, importResults *importResultTracker) error {
 	logger := log.WithFields(log.Fields{
 		"context":         utils.DumpIncomingContext(ctx),
 		"collection":      config.RestoreCollection(),
 		"batchSize":       config.RestoreBatchSize(),
 		"typesenseHost":   config.RestoreTypesenseHost(),
-		"typesenseAPIKey": config.RestoreTypesenseAPIKey(),
+		"typesenseAPIKey": maskSecret(config.RestoreTypesenseAPIKey()),
 		"folderPath":      config.RestoreFolderPath(),
-		"filePath":        filePath,
+		"fileName":        fileName,
 	})
 
-	file, err := os.Open(filePath)
+	file, err := st.Open(fileName)
 	if err != nil {
 		logger.Error(err)
 		return err
 	}
 	defer file.Close()
 
+	reader, err := newDecompressReader(fileName, file)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+	defer reader.Close()
+
+	startLine := state.importedLines(fileName) + 1
+	if startLine > 1 {
+		log.Printf("Resuming file %s from line %d\n", fileName, startLine)
+	}
+
+	err = pipeline.run(ctx, func(ctx context.Context, emit func(job importJob) error) error {
+		return readRestoreBatches(reader, startLine, func(seq int, lines [][]byte, lastLine int) error {
+			return emit(newRestoreJob(fileName, seq, lines, lastLine, state, importResults))
+		})
+	})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	if err := state.markFileCompleted(fileName); err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// readRestoreBatches groups the lines of a backup file from startLine on into batches of restore.batch_size lines,
+// fn receives each batch with its number and the number of its last line in the file
+func readRestoreBatches(reader io.Reader, startLine int, fn func(seq int, lines [][]byte, lastLine int) error) error {
 	var (
-		scanner     = bufio.NewScanner(file)
-		buffer      bytes.Buffer
-		batches     [][]byte
+		scanner     = newLineScanner(reader, config.RestoreMaxLineSize())
+		lines       [][]byte
+		seq         = 0
 		currentLine = 0
-		startLine   = 1
 	)
 
 	for scanner.Scan() {
@@ -131,40 +382,107 @@ func restoreFromFile(ctx context.Context, client typesense.APIClientInterface, f
 			continue
 		}
 
-		buffer.Write(scanner.Bytes())
-		buffer.WriteByte('\n')
-
-		if (currentLine-startLine+1)%config.RestoreBatchSize() == 0 {
-			batches = append(batches, append([]byte{}, buffer.Bytes()...))
-			buffer.Reset()
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+		if len(lines) == config.RestoreBatchSize() {
+			if err := fn(seq, lines, currentLine); err != nil {
+				return err
+			}
+			seq++
+			lines = nil
 		}
 	}
 
-	if buffer.Len() > 0 {
-		batches = append(batches, append([]byte{}, buffer.Bytes()...))
+	if err := scanner.Err(); err != nil {
+		return lineScanError(err, currentLine+1, "restore.max_line_size", config.RestoreMaxLineSize())
 	}
 
-	if err := scanner.Err(); err != nil {
-		logger.Error(err)
-		return err
+	if len(lines) > 0 {
+		return fn(seq, lines, currentLine)
 	}
 
-	for i, batch := range batches {
-		log.Printf("Sending batch %d from file %s\n", i+1, filePath)
+	return nil
+}
 
-		if err := sendBatch(ctx, client, batch); err != nil {
-			logger.Error(err)
-			return err
-		}
+// newLineScanner reads lines of up to maxLineSize bytes, the buffer only grows up to that size for long lines
+func newLineScanner(reader io.Reader, maxLineSize int) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, min(bufio.MaxScanTokenSize, maxLineSize)), maxLineSize)
+
+	return scanner
+}
+
+// lineScanError names the setting to raise when a line is longer than the scanner accepts
+func lineScanError(err error, line int, key string, maxLineSize int) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("line %d is longer than %s of %d bytes: %w", line, key, maxLineSize, err)
+	}
+
+	return err
+}
+
+// newRestoreJob returns the pipeline job transforming and importing a batch of backup lines, then recording the last
+// line of the batch in the restore state
+func newRestoreJob(fileName string, seq int, lines [][]byte, lastLine int, state *restoreState, importResults *importResultTracker) importJob {
+	return importJob{
+		seq: seq,
+		prepare: func(transformer *documentTransformer) ([]byte, int, error) {
+			log.Printf("Sending batch %d from file %s\n", seq+1, fileName)
+
+			var buffer bytes.Buffer
+			for _, line := range lines {
+				if err := writeRestoreLine(&buffer, line, transformer, importResults); err != nil {
+					return nil, 0, err
+				}
+			}
+			return buffer.Bytes(), len(lines), nil
+		},
+		commit: func() error {
+			return state.markBatchImported(fileName, lastLine)
+		},
+	}
+}
+
+func newRestoreTransformer() (*documentTransformer, error) {
+	return newDocumentTransformer(nil, config.RestoreTransformScript())
+}
+
+// writeRestoreLine appends a line of a backup file to the batch, after running it through the transform script when one is configured
+func writeRestoreLine(buffer *bytes.Buffer, line []byte, transformer *documentTransformer, importResults *importResultTracker) error {
+	if transformer.isEmpty() {
+		buffer.Write(line)
+		buffer.WriteByte('\n')
+		return nil
 	}
 
+	var doc map[string]any
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return importResults.reject(line, err)
+	}
+
+	_, err := transformer.encode(buffer, doc, line, importResults)
+	return err
+}
+
+// sendBatch skips the import of a batch left empty by the transform script, but still checks the failure ratio
+func sendBatch(ctx context.Context, client typesense.APIClientInterface, batchData []byte, importResults *importResultTracker) error {
+	if len(batchData) == 0 {
+		return importResults.checkFailureRatio()
+	}
+
+	if err := importDocuments(ctx, client, config.RestoreCollection(), config.RestoreBatchSize(), batchData, importResults); err != nil {
+		return err
+	}
+
+	time.Sleep(config.RestoreSleepInterval())
+
 	return nil
 }
 
-func sendBatch(ctx context.Context, client typesense.APIClientInterface, batchData []byte) error {
-	resp, err := client.ImportDocumentsWithBodyWithResponse(ctx, config.RestoreCollection(), &typesenseAPI.ImportDocumentsParams{
+// importDocuments upserts a JSONL batch into collection and tracks the result of every document
+func importDocuments(ctx context.Context, client typesense.APIClientInterface, collection string, batchSize int, batchData []byte, importResults *importResultTracker) error {
+	resp, err := client.ImportDocumentsWithBodyWithResponse(ctx, collection, &typesenseAPI.ImportDocumentsParams{
 		Action:    typesensePtr.String("upsert"),
-		BatchSize: typesensePtr.Int(config.RestoreBatchSize()),
+		BatchSize: typesensePtr.Int(batchSize),
 	}, "application/jsonl", bytes.NewReader(batchData))
 	if err != nil {
 		log.Error(err)
@@ -177,7 +495,10 @@ func sendBatch(ctx context.Context, client typesense.APIClientInterface, batchDa
 		return err
 	}
 
-	time.Sleep(config.RestoreSleepInterval())
+	if err := importResults.track(resp.Body, batchData); err != nil {
+		log.Error(err)
+		return err
+	}
 
 	return nil
 }
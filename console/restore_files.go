@@ -0,0 +1,174 @@
+package console
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"typesense-migration-tools/config"
+)
+
+// restoreFileSelection limits a restore to the files of restore.files, or to the files matching restore.include and
+// none of restore.exclude
+type restoreFileSelection struct {
+	files   []string
+	include []string
+	exclude []string
+}
+
+func newRestoreFileSelection() *restoreFileSelection {
+	return &restoreFileSelection{
+		files:   config.RestoreFiles(),
+		include: config.RestoreInclude(),
+		exclude: config.RestoreExclude(),
+	}
+}
+
+func (s *restoreFileSelection) isEmpty() bool {
+	return len(s.files) == 0 && len(s.include) == 0 && len(s.exclude) == 0
+}
+
+func (s *restoreFileSelection) matches(name string) bool {
+	if len(s.files) > 0 {
+		return slices.Contains(s.files, name)
+	}
+
+	if len(s.include) > 0 && !matchesAnyPattern(s.include, name) {
+		return false
+	}
+
+	return !matchesAnyPattern(s.exclude, name)
+}
+
+// apply returns the selected files, every file of restore.files must have been found
+func (s *restoreFileSelection) apply(found []string) ([]string, error) {
+	for _, name := range s.files {
+		if !slices.Contains(found, name) {
+			return nil, fmt.Errorf("file %s of restore.files is not a backup file of %s", name, config.RestoreFolderPath())
+		}
+	}
+
+	var files []string
+	for _, name := range found {
+		if s.matches(name) {
+			files = append(files, name)
+		}
+	}
+
+	return files, nil
+}
+
+// order returns the files in the order of restore.files when set, otherwise in the order of the manifest, which is
+// the order they were written in, with the files it does not list last
+func (s *restoreFileSelection) order(files []string, manifest *backupManifest) []string {
+	if len(s.files) > 0 {
+		return slices.Clone(s.files)
+	}
+
+	if manifest == nil {
+		return files
+	}
+
+	position := make(map[string]int, len(manifest.Files))
+	for i, file := range manifest.Files {
+		position[file.Name] = i
+	}
+
+	ordered := slices.Clone(files)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		positionA, listedA := position[a]
+		positionB, listedB := position[b]
+		switch {
+		case listedA && listedB:
+			return positionA - positionB
+		case listedA:
+			return -1
+		case listedB:
+			return 1
+		}
+		return 0
+	})
+
+	return ordered
+}
+
+// manifestSubset returns a copy of the manifest limited to the selected files, so that files left out are not verified
+func (s *restoreFileSelection) manifestSubset(manifest *backupManifest) *backupManifest {
+	if s.isEmpty() {
+		return manifest
+	}
+
+	subset := *manifest
+	subset.Files = nil
+	for _, file := range manifest.Files {
+		if s.matches(file.Name) {
+			subset.Files = append(subset.Files, file)
+		}
+	}
+
+	return &subset
+}
+
+func matchesAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validatePatterns(key string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: invalid pattern %s: %w", key, pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// naturalLess compares the runs of digits of file names by their numeric value, so that backup_chunk_2.jsonl comes
+// before backup_chunk_10.jsonl
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		chunkA, restA := nextNaturalChunk(a)
+		chunkB, restB := nextNaturalChunk(b)
+		if chunkA != chunkB {
+			return naturalChunkLess(chunkA, chunkB)
+		}
+		a, b = restA, restB
+	}
+
+	return len(a) < len(b)
+}
+
+// nextNaturalChunk splits the leading run of digits or of non-digits from s
+func nextNaturalChunk(s string) (string, string) {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+func naturalChunkLess(a, b string) bool {
+	if isDigit(a[0]) && isDigit(b[0]) {
+		trimmedA, trimmedB := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(trimmedA) != len(trimmedB) {
+			return len(trimmedA) < len(trimmedB)
+		}
+		if trimmedA != trimmedB {
+			return trimmedA < trimmedB
+		}
+	}
+
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
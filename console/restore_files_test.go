@@ -0,0 +1,83 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNaturalLess(t *testing.T) {
+	files := []string{"backup_chunk_10.jsonl", "backup_chunk_2.jsonl.gz", "backup_chunk_1.jsonl", "backup_chunk_02.jsonl", "a.jsonl", "backup_chunk_100.jsonl"}
+	sort.Slice(files, func(i, j int) bool {
+		return naturalLess(files[i], files[j])
+	})
+
+	assert.Equal(t, []string{"a.jsonl", "backup_chunk_1.jsonl", "backup_chunk_02.jsonl", "backup_chunk_2.jsonl.gz", "backup_chunk_10.jsonl", "backup_chunk_100.jsonl"}, files)
+}
+
+func TestRestoreFileSelection(t *testing.T) {
+	found := []string{"backup_chunk_0.jsonl", "backup_chunk_1.jsonl", "backup_chunk_2.jsonl", "extra_0.jsonl"}
+
+	t.Run("keep the files matching include and not exclude", func(t *testing.T) {
+		selection := &restoreFileSelection{include: []string{"backup_chunk_*"}, exclude: []string{"*_1.jsonl"}}
+
+		files, err := selection.apply(found)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"backup_chunk_0.jsonl", "backup_chunk_2.jsonl"}, files)
+	})
+
+	t.Run("restore the explicit files in their order", func(t *testing.T) {
+		selection := &restoreFileSelection{files: []string{"backup_chunk_2.jsonl", "backup_chunk_0.jsonl"}}
+
+		files, err := selection.apply(found)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"backup_chunk_2.jsonl", "backup_chunk_0.jsonl"}, selection.order(files, nil))
+
+		_, err = (&restoreFileSelection{files: []string{"missing.jsonl"}}).apply(found)
+		assert.Error(t, err)
+	})
+
+	t.Run("follow the manifest order with unlisted files last", func(t *testing.T) {
+		manifest := &backupManifest{Files: []backupManifestFile{{Name: "backup_chunk_2.jsonl"}, {Name: "backup_chunk_0.jsonl"}, {Name: "backup_chunk_1.jsonl"}}}
+
+		assert.Equal(t, []string{"backup_chunk_2.jsonl", "backup_chunk_0.jsonl", "backup_chunk_1.jsonl", "extra_0.jsonl"}, (&restoreFileSelection{}).order(found, manifest))
+	})
+
+	t.Run("only verify the selected files of the manifest", func(t *testing.T) {
+		manifest := &backupManifest{Files: []backupManifestFile{{Name: "backup_chunk_0.jsonl"}, {Name: "backup_chunk_1.jsonl"}}}
+		selection := &restoreFileSelection{exclude: []string{"backup_chunk_0.jsonl"}}
+
+		assert.Equal(t, []backupManifestFile{{Name: "backup_chunk_1.jsonl"}}, selection.manifestSubset(manifest).Files)
+		assert.Len(t, manifest.Files, 2)
+	})
+}
+
+func TestFindBackupFiles(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("restore.rejected_file_path", "out/backup_chunk_9.jsonl")
+
+	dir := t.TempDir()
+	for _, name := range []string{"backup_chunk_10.jsonl", "backup_chunk_2.jsonl.gz", "export.jsonl", "rejected.jsonl", "verify_report.jsonl", "notes.jsonl", "backup_chunk_9.jsonl", "schema.json"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	st := &localStorage{folderPath: dir}
+
+	t.Run("only take the chunk files for backup files", func(t *testing.T) {
+		files, err := findBackupFiles(st)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"backup_chunk_2.jsonl.gz", "backup_chunk_10.jsonl"}, files)
+	})
+
+	t.Run("take the files listed in the manifest as well", func(t *testing.T) {
+		require.NoError(t, writeManifestFile(st, &backupManifest{Files: []backupManifestFile{{Name: "export.jsonl"}}}))
+
+		files, err := findBackupFiles(st)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"backup_chunk_2.jsonl.gz", "backup_chunk_10.jsonl", "export.jsonl"}, files)
+	})
+}
@@ -0,0 +1,350 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"typesense-migration-tools/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
+)
+
+var restoreSnapshotCmd = &cobra.Command{
+	Use:   "restore-snapshot",
+	Short: "restore a typesense cluster snapshot",
+	Long:  `This subcommand restore the collections, documents, aliases, synonyms, overrides, stopwords, presets and analytics rules of a snapshot`,
+	Run:   runRestoreSnapshot,
+}
+
+func init() {
+	addTypesenseFlags(restoreSnapshotCmd, "", "restore_snapshot")
+	addStringFlag(restoreSnapshotCmd, "folder-path", "restore_snapshot.folder_path")
+	addIntFlag(restoreSnapshotCmd, "batch-size", "restore_snapshot.batch_size")
+	addDurationFlag(restoreSnapshotCmd, "sleep-interval", "restore_snapshot.sleep_interval")
+	RootCmd.AddCommand(restoreSnapshotCmd)
+}
+
+func runRestoreSnapshot(_ *cobra.Command, _ []string) {
+	err := validateRestoreSnapshotConfig()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	ctx := context.TODO()
+	st, err := newStorage(ctx, config.RestoreSnapshotFolderPath())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	manifest, err := readSnapshotManifestFile(st)
+	switch {
+	case err != nil:
+		log.Error(err)
+		return
+	case manifest == nil:
+		log.Errorf("no %s found in %s, the snapshot is incomplete", snapshotManifestFileName, st)
+		return
+	}
+
+	collections, err := selectSnapshotCollections(manifest)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fmt.Printf("Typesense Host: %s\n", config.RestoreSnapshotTypesenseHost())
+	fmt.Printf("Typesense API Key: %s\n", maskSecret(config.RestoreSnapshotTypesenseAPIKey()))
+	fmt.Printf("Folder Path: %s\n", config.RestoreSnapshotFolderPath())
+	fmt.Printf("Snapshot Source Host: %s\n", manifest.TypesenseHost)
+	fmt.Printf("Snapshot Finished At: %s\n", manifest.FinishedAt.Format(time.RFC3339))
+	fmt.Printf("Collections: %s\n", strings.Join(collections, ","))
+	fmt.Printf("Batch Size: %d\n", config.RestoreSnapshotBatchSize())
+	if !confirmProceed(os.Stdout, os.Stdin) {
+		log.Println("Restore snapshot operation cancelled.")
+		return
+	}
+
+	tsClient, err := newTypesenseClient(config.RestoreSnapshotTypesenseConnection())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	importResults := newImportResultTracker(config.RestoreSnapshotRejectedFilePath(), config.RestoreSnapshotMaxFailureRatio())
+	defer importResults.Close()
+
+	// stopwords sets come first and aliases, presets and analytics rules last, since they may refer to the collections
+	if err := restoreSnapshotResource(ctx, st, tsClient, stopwordsResource); err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, collection := range collections {
+		log.Printf("Restoring collection: %s\n", collection)
+		if err := restoreSnapshotCollection(ctx, st, tsClient, collection, importResults); err != nil {
+			log.Error(fmt.Errorf("error restoring collection %s: %w", collection, err))
+			return
+		}
+	}
+
+	if err := restoreSnapshotAliases(ctx, st, tsClient, collections); err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, resource := range []clusterResource{presetsResource, analyticsRulesResource} {
+		if err := restoreSnapshotResource(ctx, st, tsClient, resource); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	warnSnapshotAPIKeys(st)
+
+	log.Printf("Snapshot successfully restored to %s", config.RestoreSnapshotTypesenseHost())
+}
+
+func validateRestoreSnapshotConfig() error {
+	if err := validateClusterReference("restore_snapshot", config.RestoreSnapshotCluster()); err != nil {
+		return err
+	}
+
+	parsedURL, err := url.Parse(config.RestoreSnapshotTypesenseHost())
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid typesense host URL: %s", config.RestoreSnapshotTypesenseHost())
+	}
+
+	if err := validateTLSSettings("restore_snapshot", config.RestoreSnapshotCluster(), config.RestoreSnapshotTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
+	switch {
+	case config.RestoreSnapshotTypesenseAPIKey() == "":
+		return fmt.Errorf("restore_snapshot.typesense.api_key cannot be empty")
+	case config.RestoreSnapshotFolderPath() == "":
+		return fmt.Errorf("restore_snapshot.folder_path cannot be empty")
+	case config.RestoreSnapshotFolderPath() == stdioStorageURL:
+		return fmt.Errorf("restore_snapshot.folder_path cannot be stdin, a snapshot is made of several files")
+	case config.RestoreSnapshotBatchSize() <= 0:
+		return fmt.Errorf("restore_snapshot.batch_size must be a positive integer")
+	case config.RestoreSnapshotMaxLineSize() <= 0:
+		return fmt.Errorf("restore_snapshot.max_line_size must be a positive size")
+	}
+
+	return nil
+}
+
+// selectSnapshotCollections returns the collections of the snapshot to restore, limited to restore_snapshot.collections when set
+func selectSnapshotCollections(manifest *snapshotManifest) ([]string, error) {
+	inSnapshot := make(map[string]bool, len(manifest.Collections))
+	var collections []string
+	for _, collection := range manifest.Collections {
+		inSnapshot[collection.Name] = true
+		collections = append(collections, collection.Name)
+	}
+
+	if len(config.RestoreSnapshotCollections()) == 0 {
+		return collections, nil
+	}
+
+	for _, name := range config.RestoreSnapshotCollections() {
+		if !inSnapshot[name] {
+			return nil, fmt.Errorf("collection %s listed in restore_snapshot.collections is not part of the snapshot", name)
+		}
+	}
+
+	return config.RestoreSnapshotCollections(), nil
+}
+
+func restoreSnapshotResource(ctx context.Context, st storage, client typesense.APIClientInterface, resource clusterResource) error {
+	items, err := readResourcesFile(st, resource)
+	if err != nil {
+		return err
+	}
+
+	if err := upsertResources(ctx, client, resource, items); err != nil {
+		return err
+	}
+
+	if len(items) > 0 {
+		log.Printf("%d %s successfully restored from %s", len(items), resource.name, resource.fileName)
+	}
+
+	return nil
+}
+
+// restoreSnapshotAliases only restores the aliases pointing to a restored collection
+func restoreSnapshotAliases(ctx context.Context, st storage, client typesense.APIClientInterface, collections []string) error {
+	aliases, err := readResourcesFile(st, aliasesResource)
+	if err != nil {
+		return err
+	}
+
+	restored := make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		restored[collection] = true
+	}
+	aliases = filterAliases(aliases, restored)
+
+	if err := upsertResources(ctx, client, aliasesResource, aliases); err != nil {
+		return err
+	}
+
+	log.Printf("%d aliases successfully restored from %s", len(aliases), aliasesResource.fileName)
+
+	return nil
+}
+
+// restoreSnapshotCollection creates the collection when it does not exist, imports its documents and then its synonyms and overrides
+func restoreSnapshotCollection(ctx context.Context, st storage, client typesense.APIClientInterface, collection string, importResults *importResultTracker) error {
+	sub, err := st.Sub(path.Join(snapshotCollectionsDir, collection))
+	if err != nil {
+		return err
+	}
+
+	if err := ensureSnapshotCollection(ctx, sub, client, collection); err != nil {
+		return err
+	}
+
+	files, err := verifiedSnapshotFiles(sub)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := importSnapshotFile(ctx, sub, client, collection, file, importResults); err != nil {
+			return fmt.Errorf("error importing file %s: %w", file, err)
+		}
+	}
+
+	for _, resource := range []clusterResource{synonymsResource(collection), overridesResource(collection)} {
+		if err := restoreSnapshotResource(ctx, sub, client, resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ensureSnapshotCollection(ctx context.Context, st storage, client typesense.APIClientInterface, collection string) error {
+	exists, err := isCollectionExists(ctx, client, collection)
+	switch {
+	case err != nil:
+		return err
+	case exists:
+		log.Warnf("collection %s already exists, documents are upserted into it", collection)
+		return nil
+	}
+
+	schema, err := readSchemaFile(st)
+	switch {
+	case err != nil:
+		return err
+	case schema == nil:
+		return fmt.Errorf("no %s found in %s", schemaFileName, st)
+	}
+
+	return createCollectionFromSchema(ctx, client, collection, schema)
+}
+
+// verifiedSnapshotFiles returns the document files of a collection folder once they all match its manifest
+func verifiedSnapshotFiles(st storage) ([]string, error) {
+	files, err := findBackupFiles(st)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readManifestFile(st)
+	switch {
+	case err != nil:
+		return nil, err
+	case manifest == nil:
+		return nil, fmt.Errorf("no %s found in %s", manifestFileName, st)
+	}
+
+	if errs := verifyBackupFiles(st, manifest, files); len(errs) > 0 {
+		return nil, fmt.Errorf("document files do not match %s: %w", manifestFileName, errors.Join(errs...))
+	}
+
+	return files, nil
+}
+
+func importSnapshotFile(ctx context.Context, st storage, client typesense.APIClientInterface, collection, fileName string, importResults *importResultTracker) error {
+	file, err := st.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := newDecompressReader(fileName, file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var (
+		scanner = newLineScanner(reader, config.RestoreSnapshotMaxLineSize())
+		buffer  bytes.Buffer
+		lines   = 0
+	)
+
+	for scanner.Scan() {
+		buffer.Write(scanner.Bytes())
+		buffer.WriteByte('\n')
+		lines++
+
+		if lines%config.RestoreSnapshotBatchSize() == 0 {
+			if err := sendSnapshotBatch(ctx, client, collection, buffer.Bytes(), importResults); err != nil {
+				return err
+			}
+			buffer.Reset()
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lineScanError(err, lines+1, "restore_snapshot.max_line_size", config.RestoreSnapshotMaxLineSize())
+	}
+
+	if buffer.Len() > 0 {
+		return sendSnapshotBatch(ctx, client, collection, buffer.Bytes(), importResults)
+	}
+
+	return nil
+}
+
+func sendSnapshotBatch(ctx context.Context, client typesense.APIClientInterface, collection string, batchData []byte, importResults *importResultTracker) error {
+	if err := importDocuments(ctx, client, collection, config.RestoreSnapshotBatchSize(), batchData, importResults); err != nil {
+		return err
+	}
+
+	time.Sleep(config.RestoreSnapshotSleepInterval())
+
+	return nil
+}
+
+// warnSnapshotAPIKeys lists the API keys of the snapshot, they have to be recreated by hand since their values are never exported
+func warnSnapshotAPIKeys(st storage) {
+	keys, err := readResourcesFile(st, apiKeysResource)
+	switch {
+	case err != nil:
+		log.Warn(err)
+		return
+	case len(keys) == 0:
+		return
+	}
+
+	log.Warnf("%d API keys in %s are not restored, typesense does not export key values so they have to be recreated:", len(keys), apiKeysResource.fileName)
+	for _, key := range keys {
+		log.Warnf("key %v starting with %v: %v", key["id"], key["value_prefix"], key["description"])
+	}
+}
@@ -0,0 +1,105 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+	"typesense-migration-tools/config"
+)
+
+const restoreStateFileName = "restore_state.json"
+
+// restoreState records which backup files were fully imported and, for the file in progress, the last line
+// that was part of a successfully imported batch, so that a restore can be continued with --resume
+type restoreState struct {
+	Collection     string         `json:"collection"`
+	CompletedFiles []string       `json:"completed_files"`
+	ImportedLines  map[string]int `json:"imported_lines"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+
+	storage storage
+}
+
+func newRestoreState(st storage) *restoreState {
+	return &restoreState{
+		Collection:    config.RestoreCollection(),
+		ImportedLines: make(map[string]int),
+		storage:       st,
+	}
+}
+
+// isCompleted reports whether the whole file has already been imported
+func (s *restoreState) isCompleted(name string) bool {
+	for _, completed := range s.CompletedFiles {
+		if completed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// importedLines returns the number of lines of the file that have already been imported
+func (s *restoreState) importedLines(name string) int {
+	return s.ImportedLines[name]
+}
+
+func (s *restoreState) markBatchImported(name string, lastLine int) error {
+	s.ImportedLines[name] = lastLine
+	return s.save()
+}
+
+func (s *restoreState) markFileCompleted(name string) error {
+	delete(s.ImportedLines, name)
+	s.CompletedFiles = append(s.CompletedFiles, name)
+	return s.save()
+}
+
+// save writes the state next to the backup files, only on storages supporting --resume, so that a restore from S3 or
+// stdin neither writes into the backup nor needs write access to it
+func (s *restoreState) save() error {
+	if !isResumableStorage(s.storage) {
+		return nil
+	}
+
+	s.UpdatedAt = time.Now().UTC()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.storage.WriteFile(restoreStateFileName, b)
+}
+
+func (s *restoreState) remove() error {
+	if !isResumableStorage(s.storage) {
+		return nil
+	}
+
+	return s.storage.Remove(restoreStateFileName)
+}
+
+// readRestoreState returns nil without error when the storage does not contain a restore state
+func readRestoreState(st storage) (*restoreState, error) {
+	b, err := st.ReadFile(restoreStateFileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	state := newRestoreState(st)
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", restoreStateFileName, err)
+	}
+
+	if state.ImportedLines == nil {
+		state.ImportedLines = make(map[string]int)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,74 @@
+package console
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineScanner(t *testing.T) {
+	long := strings.Repeat("x", 2*bufio.MaxScanTokenSize)
+
+	t.Run("read lines longer than the default scanner limit", func(t *testing.T) {
+		scanner := newLineScanner(strings.NewReader("a\n"+long+"\nb\n"), 4*bufio.MaxScanTokenSize)
+
+		var lengths []int
+		for scanner.Scan() {
+			lengths = append(lengths, len(scanner.Bytes()))
+		}
+		assert.NoError(t, scanner.Err())
+		assert.Equal(t, []int{1, len(long), 1}, lengths)
+	})
+
+	t.Run("name the setting of a line too long", func(t *testing.T) {
+		scanner := newLineScanner(strings.NewReader("a\n"+long+"\n"), bufio.MaxScanTokenSize)
+		lines := 0
+		for scanner.Scan() {
+			lines++
+		}
+
+		err := lineScanError(scanner.Err(), lines+1, "restore.max_line_size", bufio.MaxScanTokenSize)
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+		assert.EqualError(t, err, "line 2 is longer than restore.max_line_size of 65536 bytes: bufio.Scanner: token too long")
+	})
+}
+
+// writeRecordingStorage stands for a storage without --resume support, such as S3, and records the files written
+type writeRecordingStorage struct {
+	storage
+	written []string
+}
+
+func (s *writeRecordingStorage) WriteFile(name string, _ []byte) error {
+	s.written = append(s.written, name)
+	return nil
+}
+
+func (s *writeRecordingStorage) Remove(name string) error {
+	s.written = append(s.written, name)
+	return nil
+}
+
+func TestRestoreStateSave(t *testing.T) {
+	t.Run("leave the backup untouched on storages without resume", func(t *testing.T) {
+		st := &writeRecordingStorage{}
+		state := newRestoreState(st)
+
+		require.NoError(t, state.markBatchImported("backup_chunk_0.jsonl", 100))
+		require.NoError(t, state.markFileCompleted("backup_chunk_0.jsonl"))
+		require.NoError(t, state.remove())
+		assert.Empty(t, st.written)
+	})
+
+	t.Run("save the state in a local folder", func(t *testing.T) {
+		folder := t.TempDir()
+		state := newRestoreState(&localStorage{folderPath: folder})
+
+		require.NoError(t, state.markBatchImported("backup_chunk_0.jsonl", 100))
+		assert.FileExists(t, filepath.Join(folder, restoreStateFileName))
+	})
+}
@@ -9,13 +9,20 @@ import (
 	runtime "github.com/banzaicloud/logrus-runtime-formatter"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// Version of the tool, it is recorded in backup manifests and can be set at build time with
+// -ldflags "-X typesense-migration-tools/console.Version=v1.0.0"
+var Version = "dev"
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
-	Use:   "typesense-migration-tools",
-	Short: "Typesense Migration Tools CLI",
-	Long:  `CLI Tools for Typesense Migration Tools`,
+	Use:               "typesense-migration-tools",
+	Short:             "Typesense Migration Tools CLI",
+	Long:              `CLI Tools for Typesense Migration Tools`,
+	Version:           Version,
+	PersistentPreRunE: setupCommand,
 }
 
 // Execute runs the root command of the CLI application
@@ -27,8 +34,33 @@ func Execute() {
 }
 
 func init() {
-	config.GetConf()
+	RootCmd.PersistentFlags().String("config", "", "config file to read instead of looking for config.yml in the working directory and its parents")
+	RootCmd.PersistentFlags().BoolP("yes", "y", false, "proceed without asking for confirmation")
+	_ = viper.BindPFlag("assume_yes", RootCmd.PersistentFlags().Lookup("yes"))
+}
+
+// setupCommand reads the config once the flags are parsed, then lets the flags of the command being run override it
+func setupCommand(cmd *cobra.Command, _ []string) error {
+	// the flags are valid at this point, Execute prints the error without the usage
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	configFile, _ := cmd.Flags().GetString("config")
+	if err := config.GetConf(configFile); err != nil {
+		return err
+	}
+
+	if err := bindConfigFlags(cmd); err != nil {
+		return err
+	}
+
+	// the logger masks the secrets set by flags and read from files or secret stores as well
+	if err := resolveConfigSecrets(cmd.Context()); err != nil {
+		return err
+	}
 	setupLogger()
+
+	return nil
 }
 
 func setupLogger() {
@@ -41,7 +73,11 @@ func setupLogger() {
 		File: true,
 	}
 
-	log.SetFormatter(&formatter)
+	if config.ShowSecrets() {
+		log.SetFormatter(&formatter)
+	} else {
+		log.SetFormatter(newSecretScrubbingFormatter(&formatter, config.Secrets()))
+	}
 	log.SetOutput(os.Stdout)
 
 	logLevel, err := log.ParseLevel(config.LogLevel())
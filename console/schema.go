@@ -0,0 +1,192 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"typesense-migration-tools/config"
+
+	"github.com/typesense/typesense-go/v2/typesense"
+)
+
+const schemaFileName = "schema.json"
+
+// collectionSchemaReadOnlyAttributes are returned by the retrieve collection API but rejected when creating a collection
+var collectionSchemaReadOnlyAttributes = []string{"created_at", "num_documents"}
+
+// fetchCollectionSchema retrieves the raw collection schema so that every attribute is kept, including the ones unknown to the client library
+func fetchCollectionSchema(ctx context.Context, client typesense.APIClientInterface, collection string) (map[string]any, error) {
+	resp, err := client.GetCollectionWithResponse(ctx, collection)
+	switch {
+	case err != nil:
+		return nil, err
+	case resp.StatusCode() != http.StatusOK:
+		return nil, dumpTypesenseError(resp.JSON404)
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(resp.Body, &schema); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// isCollectionExists returns false when typesense responds with 404 for the given collection
+func isCollectionExists(ctx context.Context, client typesense.APIClientInterface, collection string) (bool, error) {
+	resp, err := client.GetCollectionWithResponse(ctx, collection)
+	switch {
+	case err != nil:
+		return false, err
+	case resp.StatusCode() == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode() != http.StatusOK:
+		return false, dumpTypesenseError(string(resp.Body))
+	}
+
+	return true, nil
+}
+
+// createCollectionFromSchema creates a collection named name from a schema previously returned by fetchCollectionSchema
+func createCollectionFromSchema(ctx context.Context, client typesense.APIClientInterface, name string, schema map[string]any) error {
+	body := copySchemaMap(schema)
+	for _, attr := range collectionSchemaReadOnlyAttributes {
+		delete(body, attr)
+	}
+	body["name"] = name
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.CreateCollectionWithBodyWithResponse(ctx, "application/json", bytes.NewReader(b))
+	switch {
+	case err != nil:
+		return err
+	case resp.StatusCode() != http.StatusCreated:
+		return dumpTypesenseError(resp.JSON400, resp.JSON409)
+	}
+
+	return nil
+}
+
+// schemaOverrides describes how a copied collection schema differs from its source
+type schemaOverrides struct {
+	addFields           []map[string]any
+	dropFields          []string
+	retypeFields        []config.FieldType
+	defaultSortingField string
+}
+
+// applySchemaOverrides returns a copy of schema with the fields dropped, retyped and added in that order. When the
+// default sorting field is dropped without a replacement, the copy falls back to typesense's default sort.
+func applySchemaOverrides(schema map[string]any, overrides schemaOverrides) (map[string]any, error) {
+	fields, err := schemaFields(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range overrides.dropFields {
+		i := schemaFieldIndex(fields, name)
+		if i < 0 {
+			return nil, fmt.Errorf("field %s to drop is not in the schema", name)
+		}
+		fields = append(fields[:i], fields[i+1:]...)
+	}
+
+	for _, retype := range overrides.retypeFields {
+		i := schemaFieldIndex(fields, retype.Name)
+		if i < 0 {
+			return nil, fmt.Errorf("field %s to retype is not in the schema", retype.Name)
+		}
+		field := copySchemaMap(fields[i])
+		field["type"] = retype.Type
+		fields[i] = field
+	}
+
+	for _, field := range overrides.addFields {
+		name, _ := field["name"].(string)
+		if schemaFieldIndex(fields, name) >= 0 {
+			return nil, fmt.Errorf("field %s to add is already in the schema", name)
+		}
+		fields = append(fields, field)
+	}
+
+	result := copySchemaMap(schema)
+	result["fields"] = fields
+
+	sortingField, _ := result["default_sorting_field"].(string)
+	switch {
+	case overrides.defaultSortingField != "":
+		result["default_sorting_field"] = overrides.defaultSortingField
+	case sortingField != "" && schemaFieldIndex(fields, sortingField) < 0:
+		delete(result, "default_sorting_field")
+	}
+
+	return result, nil
+}
+
+func schemaFields(schema map[string]any) ([]map[string]any, error) {
+	rawFields, _ := schema["fields"].([]any)
+	fields := make([]map[string]any, 0, len(rawFields))
+	for _, rawField := range rawFields {
+		field, ok := rawField.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema field: %v", rawField)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func schemaFieldIndex(fields []map[string]any, name string) int {
+	for i, field := range fields {
+		if field["name"] == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func copySchemaMap(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
+
+func writeSchemaFile(st storage, schema map[string]any) error {
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return st.WriteFile(schemaFileName, b)
+}
+
+// readSchemaFile returns nil without error when the storage does not contain a schema file
+func readSchemaFile(st storage) (map[string]any, error) {
+	b, err := st.ReadFile(schemaFileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", schemaFileName, err)
+	}
+
+	return schema, nil
+}
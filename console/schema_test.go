@@ -0,0 +1,66 @@
+package console
+
+import (
+	"encoding/json"
+	"testing"
+	"typesense-migration-tools/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySchemaOverrides(t *testing.T) {
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"name": "articles",
+		"default_sorting_field": "views",
+		"fields": [
+			{"name": "title", "type": "string"},
+			{"name": "views", "type": "int32"},
+			{"name": "tags", "type": "string", "facet": true}
+		]
+	}`), &schema))
+
+	t.Run("drop, retype and add fields", func(t *testing.T) {
+		result, err := applySchemaOverrides(schema, schemaOverrides{
+			addFields:    []map[string]any{{"name": "published_at", "type": "int64"}},
+			dropFields:   []string{"views"},
+			retypeFields: []config.FieldType{{Name: "tags", Type: "string[]"}},
+		})
+		require.NoError(t, err)
+
+		b, err := json.Marshal(result)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"name": "articles",
+			"fields": [
+				{"name": "title", "type": "string"},
+				{"name": "tags", "type": "string[]", "facet": true},
+				{"name": "published_at", "type": "int64"}
+			]
+		}`, string(b))
+
+		assert.Equal(t, "string", schema["fields"].([]any)[2].(map[string]any)["type"], "the source schema is left untouched")
+		assert.Equal(t, "views", schema["default_sorting_field"])
+	})
+
+	t.Run("replace the default sorting field", func(t *testing.T) {
+		result, err := applySchemaOverrides(schema, schemaOverrides{
+			addFields:           []map[string]any{{"name": "published_at", "type": "int64"}},
+			defaultSortingField: "published_at",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "published_at", result["default_sorting_field"])
+	})
+
+	t.Run("reject unknown and duplicated fields", func(t *testing.T) {
+		_, err := applySchemaOverrides(schema, schemaOverrides{dropFields: []string{"body"}})
+		assert.Error(t, err)
+
+		_, err = applySchemaOverrides(schema, schemaOverrides{retypeFields: []config.FieldType{{Name: "body", Type: "string"}}})
+		assert.Error(t, err)
+
+		_, err = applySchemaOverrides(schema, schemaOverrides{addFields: []map[string]any{{"name": "title", "type": "string"}}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,73 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dop251/goja"
+)
+
+const scriptTransformFunctionName = "transform"
+
+// scriptTransform runs the transform function of a JavaScript file on every document. The function receives the
+// document as an object and returns a document, null or undefined to skip it, or an array of documents to fan out.
+// A runtime is not safe for concurrent use.
+type scriptTransform struct {
+	runtime   *goja.Runtime
+	transform goja.Callable
+}
+
+func newScriptTransform(scriptPath string) (*scriptTransform, error) {
+	src, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := goja.New()
+	if _, err := runtime.RunScript(scriptPath, string(src)); err != nil {
+		return nil, err
+	}
+
+	transform, ok := goja.AssertFunction(runtime.Get(scriptTransformFunctionName))
+	if !ok {
+		return nil, fmt.Errorf("%s does not define a %s(doc) function", scriptPath, scriptTransformFunctionName)
+	}
+
+	return &scriptTransform{
+		runtime:   runtime,
+		transform: transform,
+	}, nil
+}
+
+func (s *scriptTransform) apply(doc map[string]any) ([]map[string]any, error) {
+	result, err := s.transform(goja.Undefined(), s.runtime.ToValue(doc))
+	if err != nil {
+		var exception *goja.Exception
+		if errors.As(err, &exception) {
+			return nil, errors.New(exception.Value().String())
+		}
+		return nil, err
+	}
+
+	if goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, nil
+	}
+
+	switch exported := result.Export().(type) {
+	case map[string]any:
+		return []map[string]any{exported}, nil
+	case []any:
+		docs := make([]map[string]any, 0, len(exported))
+		for _, item := range exported {
+			doc, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s returned an array holding %v instead of documents", scriptTransformFunctionName, item)
+			}
+			docs = append(docs, doc)
+		}
+		return docs, nil
+	}
+
+	return nil, fmt.Errorf("%s returned %v instead of a document, an array of documents or null", scriptTransformFunctionName, result)
+}
@@ -0,0 +1,61 @@
+package console
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptTransform(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "transform.js")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(`
+function transform(doc) {
+	if (doc.hidden) {
+		return null;
+	}
+	if (doc.variants) {
+		return doc.variants.map(function (v) { return { id: doc.id + "-" + v, variant: v }; });
+	}
+	if (!doc.title) {
+		throw new Error("missing title");
+	}
+	doc.title = doc.title.toUpperCase();
+	return doc;
+}
+`), 0o644))
+
+	script, err := newScriptTransform(scriptPath)
+	require.NoError(t, err)
+
+	t.Run("modify the document", func(t *testing.T) {
+		docs, err := script.apply(map[string]any{"id": "1", "title": "hello"})
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"id": "1", "title": "HELLO"}}, docs)
+	})
+
+	t.Run("skip the document", func(t *testing.T) {
+		docs, err := script.apply(map[string]any{"id": "1", "hidden": true})
+		require.NoError(t, err)
+		assert.Empty(t, docs)
+	})
+
+	t.Run("fan out the document", func(t *testing.T) {
+		docs, err := script.apply(map[string]any{"id": "1", "variants": []any{"a", "b"}})
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]any{{"id": "1-a", "variant": "a"}, {"id": "1-b", "variant": "b"}}, docs)
+	})
+
+	t.Run("return the thrown error", func(t *testing.T) {
+		_, err := script.apply(map[string]any{"id": "1"})
+		assert.EqualError(t, err, "Error: missing title")
+	})
+
+	t.Run("require a transform function", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(scriptPath, []byte(`var x = 1;`), 0o644))
+		_, err := newScriptTransform(scriptPath)
+		assert.Error(t, err)
+	})
+}
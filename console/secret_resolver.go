@@ -0,0 +1,198 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+)
+
+// envReferencePattern matches the ${VAR} references replaced by environment variables in the settings
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secretResolver reads a secret from an external secret store, secret settings refer to it with a value such as
+// vault:secret/data/typesense#api_key, where vault is the scheme the resolver is registered for
+type secretResolver interface {
+	resolve(ctx context.Context, reference string) (string, error)
+}
+
+// resolveConfigSecrets replaces the ${VAR} references of the settings by environment variables, then fills the
+// secret settings from their _file setting or from the secret store their value refers to
+func resolveConfigSecrets(ctx context.Context) error {
+	if err := interpolateEnv(); err != nil {
+		return err
+	}
+
+	if err := readSecretFiles(); err != nil {
+		return err
+	}
+
+	return resolveSecretReferences(ctx, map[string]secretResolver{
+		"vault": newVaultSecretResolver(config.SecretsVaultAddress(), config.SecretsVaultToken(), config.SecretsVaultNamespace()),
+	})
+}
+
+func interpolateEnv() error {
+	for _, key := range append(viper.AllKeys(), config.SecretKeys()...) {
+		value, ok := viper.Get(key).(string)
+		if !ok || !strings.Contains(value, "${") {
+			continue
+		}
+
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		viper.Set(key, expanded)
+	}
+
+	return nil
+}
+
+// expandEnv replaces the ${VAR} references of value, a variable that is not set is an error rather than an empty
+// string, so that a missing secret is not mistaken for an empty one
+func expandEnv(value string) (string, error) {
+	var err error
+	expanded := envReferencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReferencePattern.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return env
+	})
+
+	return expanded, err
+}
+
+// readSecretFiles fills each secret setting from the file of its _file setting, such as a mounted Kubernetes secret
+func readSecretFiles() error {
+	for _, key := range config.SecretKeys() {
+		fileKey := key + "_file"
+		fileName := viper.GetString(fileKey)
+		if fileName == "" {
+			continue
+		}
+		if viper.GetString(key) != "" {
+			return fmt.Errorf("%s and %s cannot be both set", key, fileKey)
+		}
+
+		secret, err := os.ReadFile(fileName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileKey, err)
+		}
+		viper.Set(key, strings.TrimSpace(string(secret)))
+	}
+
+	return nil
+}
+
+func resolveSecretReferences(ctx context.Context, resolvers map[string]secretResolver) error {
+	for _, key := range config.SecretKeys() {
+		scheme, reference, found := strings.Cut(viper.GetString(key), ":")
+		resolver, ok := resolvers[scheme]
+		if !found || !ok {
+			continue
+		}
+
+		secret, err := resolver.resolve(ctx, reference)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		viper.Set(key, secret)
+	}
+
+	return nil
+}
+
+// vaultSecretResolver reads secrets from the KV secrets engine, version 1 or 2, of Vault or of any server implementing
+// its HTTP API. References are written path#field, such as secret/data/typesense#api_key.
+type vaultSecretResolver struct {
+	address   string
+	token     string
+	namespace string
+	client    *http.Client
+	secrets   map[string]map[string]any
+}
+
+func newVaultSecretResolver(address, token, namespace string) *vaultSecretResolver {
+	return &vaultSecretResolver{
+		address:   strings.TrimSuffix(address, "/"),
+		token:     token,
+		namespace: namespace,
+		client:    &http.Client{Timeout: config.HTTPTimeout()},
+		secrets:   make(map[string]map[string]any),
+	}
+}
+
+func (r *vaultSecretResolver) resolve(ctx context.Context, reference string) (string, error) {
+	path, field, _ := strings.Cut(reference, "#")
+	switch {
+	case path == "" || field == "":
+		return "", fmt.Errorf("invalid vault reference %s, expected vault:path#field", reference)
+	case r.address == "":
+		return "", fmt.Errorf("secrets.vault.address must be set to resolve vault references")
+	}
+
+	data, err := r.read(ctx, strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", err
+	}
+
+	secret, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+
+	return secret, nil
+}
+
+// read returns the data of the secret at path, the secrets are read once per run since several settings often share one
+func (r *vaultSecretResolver) read(ctx context.Context, path string) (map[string]any, error) {
+	if data, ok := r.secrets[path]; ok {
+		return data, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.address+"/v1/"+path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", r.token)
+	if r.namespace != "" {
+		request.Header.Set("X-Vault-Namespace", r.namespace)
+	}
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		return nil, fmt.Errorf("unexpected response from vault reading %s, code: %d, response: %s", path, response.StatusCode, string(body))
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("decode vault secret %s: %w", path, err)
+	}
+
+	// the KV version 2 engine nests the fields of the secret under data.data, next to its metadata
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	r.secrets[path] = data
+
+	return data, nil
+}
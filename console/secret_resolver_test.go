@@ -0,0 +1,91 @@
+package console
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveConfigSecrets(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("X-Vault-Token") != "vault-token":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		case r.URL.Path == "/v1/secret/data/typesense":
+			_, _ = w.Write([]byte(`{"data":{"data":{"admin":"vault-admin-key"},"metadata":{"version":3}}}`))
+		case r.URL.Path == "/v1/kv/s3":
+			_, _ = w.Write([]byte(`{"data":{"secret_access_key":"vault-s3-secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(vault.Close)
+
+	keyFile := filepath.Join(t.TempDir(), "api-key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("file-api-key\n"), 0o600))
+	t.Setenv("TEST_TYPESENSE_HOST", "typesense.internal")
+	t.Setenv("TEST_VAULT_TOKEN", "vault-token")
+
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+secrets:
+  vault:
+    address: "`+vault.URL+`"
+    token: "${TEST_VAULT_TOKEN}"
+backup:
+  typesense:
+    host: "https://${TEST_TYPESENSE_HOST}:8108"
+    api_key_file: "`+keyFile+`"
+clusters:
+  prod-sg:
+    api_key: "vault:secret/data/typesense#admin"
+storage:
+  s3:
+    secret_access_key: "vault:kv/s3#secret_access_key"
+`)))
+
+	require.NoError(t, resolveConfigSecrets(context.Background()))
+	assert.Equal(t, "https://typesense.internal:8108", viper.GetString("backup.typesense.host"))
+	assert.Equal(t, "file-api-key", viper.GetString("backup.typesense.api_key"))
+	assert.Equal(t, "vault-admin-key", viper.GetString("clusters.prod-sg.api_key"))
+	assert.Equal(t, "vault-s3-secret", viper.GetString("storage.s3.secret_access_key"))
+
+	t.Run("mask the resolved secrets", func(t *testing.T) {
+		assert.Subset(t, config.Secrets(), []string{"vault-token", "file-api-key", "vault-admin-key", "vault-s3-secret"})
+	})
+
+	t.Run("mask the vault token read from the environment", func(t *testing.T) {
+		t.Setenv("VAULT_TOKEN", "env-vault-token")
+		viper.Set("secrets.vault.token", "")
+		t.Cleanup(func() { viper.Set("secrets.vault.token", "vault-token") })
+
+		assert.Contains(t, config.Secrets(), "env-vault-token")
+	})
+
+	t.Run("report the setting of a missing secret", func(t *testing.T) {
+		viper.Set("restore.typesense.api_key", "vault:secret/data/typesense#search")
+		t.Cleanup(func() { viper.Set("restore.typesense.api_key", "") })
+
+		resolvers := map[string]secretResolver{"vault": newVaultSecretResolver(vault.URL, "vault-token", "")}
+		assert.EqualError(t, resolveSecretReferences(context.Background(), resolvers), "restore.typesense.api_key: vault secret secret/data/typesense has no field search")
+	})
+
+	t.Run("reject an unset environment variable", func(t *testing.T) {
+		viper.Set("restore.collection", "${TEST_UNSET_COLLECTION}")
+		t.Cleanup(func() { viper.Set("restore.collection", "") })
+
+		assert.EqualError(t, interpolateEnv(), "restore.collection: environment variable TEST_UNSET_COLLECTION is not set")
+	})
+}
@@ -0,0 +1,65 @@
+package console
+
+import (
+	"slices"
+	"strings"
+	"typesense-migration-tools/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maskedSecretPrefixLength = 4
+	maskedSecretSuffix       = "***"
+)
+
+// maskSecret keeps the first characters of a secret, enough to tell keys apart, unless show_secrets is set. Short
+// secrets are masked entirely.
+func maskSecret(secret string) string {
+	switch {
+	case secret == "" || config.ShowSecrets():
+		return secret
+	case len(secret) < 2*maskedSecretPrefixLength:
+		return maskedSecretSuffix
+	}
+
+	return secret[:maskedSecretPrefixLength] + maskedSecretSuffix
+}
+
+// secretScrubbingFormatter masks the configured secrets wherever they appear in a formatted log entry, including in
+// the error messages of libraries
+type secretScrubbingFormatter struct {
+	log.Formatter
+	replacer *strings.Replacer
+}
+
+func newSecretScrubbingFormatter(formatter log.Formatter, secrets []string) *secretScrubbingFormatter {
+	// the longest secrets are replaced first, so that a secret containing another one is masked as a whole
+	secrets = slices.Clone(secrets)
+	slices.SortFunc(secrets, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+
+	var oldNew []string
+	for _, secret := range slices.Compact(secrets) {
+		// a short secret would be matched inside unrelated words of every line, real API keys are much longer
+		if len(secret) < 2*maskedSecretPrefixLength {
+			continue
+		}
+		oldNew = append(oldNew, secret, maskSecret(secret))
+	}
+
+	return &secretScrubbingFormatter{Formatter: formatter, replacer: strings.NewReplacer(oldNew...)}
+}
+
+func (f *secretScrubbingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	out, err := f.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(f.replacer.Replace(string(out))), nil
+}
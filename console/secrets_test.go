@@ -0,0 +1,33 @@
+package console
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskSecret(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	assert.Equal(t, "", maskSecret(""))
+	assert.Equal(t, "***", maskSecret("abc123"))
+	assert.Equal(t, "xyz1***", maskSecret("xyz1234567890"))
+
+	viper.Set("show_secrets", true)
+	assert.Equal(t, "xyz1234567890", maskSecret("xyz1234567890"))
+}
+
+func TestSecretScrubbingFormatter(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(newSecretScrubbingFormatter(&log.TextFormatter{DisableTimestamp: true}, []string{"admin-key-1", "admin-key-12", "admin-key-1", "k"}))
+
+	logger.WithField("typesenseAPIKey", "admin-key-12").Error(errors.New("request with key admin-key-1 failed"))
+
+	assert.Equal(t, "level=error msg=\"request with key admi*** failed\" typesenseAPIKey=admi***\n", out.String())
+}
@@ -0,0 +1,359 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"typesense-migration-tools/config"
+
+	"github.com/kumparan/go-utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+)
+
+const (
+	snapshotManifestFileName = "snapshot.json"
+	snapshotCollectionsDir   = "collections"
+)
+
+// snapshotManifest describes a complete snapshot folder, it is only written once every resource has been saved
+type snapshotManifest struct {
+	ToolVersion     string               `json:"tool_version"`
+	TypesenseHost   string               `json:"typesense_host"`
+	StartedAt       time.Time            `json:"started_at"`
+	FinishedAt      time.Time            `json:"finished_at"`
+	IncludesAPIKeys bool                 `json:"includes_api_keys"`
+	Collections     []snapshotCollection `json:"collections"`
+}
+
+type snapshotCollection struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "snapshot a typesense cluster",
+	Long:  `This subcommand backup every collection of a typesense cluster together with its aliases, synonyms, overrides, stopwords, presets and analytics rules`,
+	Run:   runSnapshot,
+}
+
+func init() {
+	addTypesenseFlags(snapshotCmd, "", "snapshot")
+	addStringFlag(snapshotCmd, "folder-path", "snapshot.folder_path")
+	addStringFlag(snapshotCmd, "compression", "snapshot.compression")
+	RootCmd.AddCommand(snapshotCmd)
+}
+
+func runSnapshot(_ *cobra.Command, _ []string) {
+	err := validateSnapshotConfig()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fmt.Printf("Typesense Host: %s\n", config.SnapshotTypesenseHost())
+	fmt.Printf("Typesense API Key: %s\n", maskSecret(config.SnapshotTypesenseAPIKey()))
+	fmt.Printf("Folder Path: %s\n", config.SnapshotFolderPath())
+	fmt.Printf("Collections: %s\n", strings.Join(config.SnapshotCollections(), ","))
+	fmt.Printf("Compression: %s\n", config.SnapshotCompression())
+	fmt.Printf("Max Docs Per File: %d\n", config.SnapshotMaxDocsPerFile())
+	fmt.Printf("Include API Keys: %t\n", config.SnapshotIncludeAPIKeys())
+	if !confirmProceed(os.Stdout, os.Stdin) {
+		log.Println("Snapshot operation cancelled.")
+		return
+	}
+
+	ctx := context.TODO()
+	st, err := newStorage(ctx, config.SnapshotFolderPath())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	tsClient, err := newTypesenseClient(config.SnapshotTypesenseConnection())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	manifest := &snapshotManifest{
+		ToolVersion:     Version,
+		TypesenseHost:   config.SnapshotTypesenseHost(),
+		StartedAt:       time.Now().UTC(),
+		IncludesAPIKeys: config.SnapshotIncludeAPIKeys(),
+	}
+
+	schemas, err := fetchSnapshotCollections(ctx, tsClient)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if err := snapshotClusterResources(ctx, st, tsClient, schemas); err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, schema := range schemas {
+		collection, err := snapshotCollectionFolder(ctx, st, tsClient, schema)
+		if err != nil {
+			log.Error(fmt.Errorf("error taking snapshot of collection %s: %w", collection.Name, err))
+			return
+		}
+		manifest.Collections = append(manifest.Collections, collection)
+	}
+
+	if err := writeSnapshotManifestFile(st, manifest); err != nil {
+		log.Error(err)
+		return
+	}
+
+	log.Printf("Snapshot of %d collections successfully saved to %s", len(manifest.Collections), st)
+}
+
+func validateSnapshotConfig() error {
+	if err := validateClusterReference("snapshot", config.SnapshotCluster()); err != nil {
+		return err
+	}
+
+	parsedURL, err := url.Parse(config.SnapshotTypesenseHost())
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid typesense host URL: %s", config.SnapshotTypesenseHost())
+	}
+
+	if err := validateTLSSettings("snapshot", config.SnapshotCluster(), config.SnapshotTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
+	switch {
+	case config.SnapshotTypesenseAPIKey() == "":
+		return fmt.Errorf("snapshot.typesense.api_key cannot be empty")
+	case config.SnapshotFolderPath() == "":
+		return fmt.Errorf("snapshot.folder_path cannot be empty")
+	case config.SnapshotFolderPath() == stdioStorageURL:
+		return fmt.Errorf("snapshot.folder_path cannot be stdout, a snapshot is made of several files")
+	case config.SnapshotMaxDocsPerFile() <= 0:
+		return fmt.Errorf("snapshot.max_docs_per_file must be a positive integer")
+	case backupFileExtension(config.SnapshotCompression()) == "":
+		return fmt.Errorf("snapshot.compression must be one of %s, %s or %s", config.CompressionNone, config.CompressionGzip, config.CompressionZstd)
+	}
+
+	return nil
+}
+
+// fetchSnapshotCollections returns the raw schema of every collection to snapshot, limited to snapshot.collections when set
+func fetchSnapshotCollections(ctx context.Context, client typesense.APIClientInterface) ([]map[string]any, error) {
+	resp, err := client.GetCollectionsWithResponse(ctx)
+	switch {
+	case err != nil:
+		return nil, err
+	case resp.StatusCode() != http.StatusOK:
+		return nil, dumpTypesenseError(string(resp.Body))
+	}
+
+	var schemas []map[string]any
+	if err := json.Unmarshal(resp.Body, &schemas); err != nil {
+		return nil, err
+	}
+
+	if len(config.SnapshotCollections()) == 0 {
+		return schemas, nil
+	}
+
+	byName := make(map[string]map[string]any, len(schemas))
+	for _, schema := range schemas {
+		name, _ := schema["name"].(string)
+		byName[name] = schema
+	}
+
+	var selected []map[string]any
+	for _, name := range config.SnapshotCollections() {
+		schema, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("collection %s listed in snapshot.collections does not exist", name)
+		}
+		selected = append(selected, schema)
+	}
+
+	return selected, nil
+}
+
+// snapshotClusterResources saves the resources that do not belong to a single collection
+func snapshotClusterResources(ctx context.Context, st storage, client typesense.APIClientInterface, schemas []map[string]any) error {
+	resources := []clusterResource{stopwordsResource, presetsResource, aliasesResource, analyticsRulesResource}
+	if config.SnapshotIncludeAPIKeys() {
+		resources = append(resources, apiKeysResource)
+	}
+
+	collections := make(map[string]bool, len(schemas))
+	for _, schema := range schemas {
+		name, _ := schema["name"].(string)
+		collections[name] = true
+	}
+
+	for _, resource := range resources {
+		items, err := fetchResources(ctx, client, resource)
+		if err != nil {
+			return err
+		}
+
+		if resource.fileName == aliasesResource.fileName && len(config.SnapshotCollections()) > 0 {
+			items = filterAliases(items, collections)
+		}
+
+		if err := writeResourcesFile(st, resource, items); err != nil {
+			return err
+		}
+
+		log.Printf("%d %s successfully saved to %s", len(items), resource.name, resource.fileName)
+	}
+
+	return nil
+}
+
+// snapshotCollectionFolder saves a collection to collections/<name>, laid out like a backup folder so that it can also be used by restore
+func snapshotCollectionFolder(ctx context.Context, st storage, client typesense.APIClientInterface, schema map[string]any) (snapshotCollection, error) {
+	name, _ := schema["name"].(string)
+	collection := snapshotCollection{Name: name}
+
+	sub, err := st.Sub(path.Join(snapshotCollectionsDir, name))
+	if err != nil {
+		return collection, err
+	}
+
+	if err := writeSchemaFile(sub, schema); err != nil {
+		return collection, err
+	}
+
+	manifest := &backupManifest{
+		ToolVersion:   Version,
+		TypesenseHost: config.SnapshotTypesenseHost(),
+		Collection:    name,
+		Mode:          config.BackupModeExport,
+		Compression:   config.SnapshotCompression(),
+		StartedAt:     time.Now().UTC(),
+	}
+
+	manifest.Files, err = exportSnapshotDocuments(ctx, sub, name)
+	if err != nil {
+		return collection, err
+	}
+
+	if err := writeManifestFile(sub, manifest); err != nil {
+		return collection, err
+	}
+	collection.Documents = manifest.TotalDocuments
+
+	for _, resource := range []clusterResource{synonymsResource(name), overridesResource(name)} {
+		items, err := fetchResources(ctx, client, resource)
+		if err != nil {
+			return collection, err
+		}
+
+		if err := writeResourcesFile(sub, resource, items); err != nil {
+			return collection, err
+		}
+	}
+
+	log.Printf("Snapshot of collection %s with %d documents successfully saved", name, collection.Documents)
+
+	return collection, nil
+}
+
+func exportSnapshotDocuments(ctx context.Context, st storage, collection string) ([]backupManifestFile, error) {
+	logger := log.WithFields(log.Fields{
+		"context":         utils.DumpIncomingContext(ctx),
+		"collection":      collection,
+		"typesenseHost":   config.SnapshotTypesenseHost(),
+		"typesenseAPIKey": maskSecret(config.SnapshotTypesenseAPIKey()),
+	})
+
+	tsClient, err := newTypesenseClientWithTimeout(config.SnapshotTypesenseConnection(), config.SnapshotExportTimeout())
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	resp, err := tsClient.ExportDocuments(ctx, collection, &typesenseAPI.ExportDocumentsParams{})
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = dumpTypesenseHTTPResponseError(resp)
+		logger.Error(err)
+		return nil, err
+	}
+
+	var (
+		chunkWriter = newBackupChunkWriter(st, config.SnapshotMaxDocsPerFile(), config.SnapshotCompression())
+		reader      = bufio.NewReader(resp.Body)
+	)
+	defer chunkWriter.Close()
+
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if doc := bytes.TrimSpace(line); len(doc) > 0 {
+			if err := chunkWriter.Write(doc); err != nil {
+				logger.Error(err)
+				return nil, err
+			}
+		}
+
+		switch {
+		case errors.Is(err, io.EOF):
+			if err := chunkWriter.Close(); err != nil {
+				return nil, err
+			}
+			return chunkWriter.files, nil
+		case err != nil:
+			logger.Error(err)
+			return nil, err
+		}
+	}
+}
+
+func writeSnapshotManifestFile(st storage, manifest *snapshotManifest) error {
+	manifest.FinishedAt = time.Now().UTC()
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return st.WriteFile(snapshotManifestFileName, b)
+}
+
+// readSnapshotManifestFile returns nil without error when the storage does not contain a snapshot manifest
+func readSnapshotManifestFile(st storage) (*snapshotManifest, error) {
+	b, err := st.ReadFile(snapshotManifestFileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	manifest := &snapshotManifest{}
+	if err := json.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", snapshotManifestFileName, err)
+	}
+
+	return manifest, nil
+}
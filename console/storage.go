@@ -0,0 +1,371 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"typesense-migration-tools/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+const stdioStorageURL = "-"
+
+// storage is where backup files are written to and read from, selected by the scheme of backup.folder_path and restore.folder_path
+type storage interface {
+	// Create opens name for writing, the content is only guaranteed to be stored once the writer is closed
+	Create(name string) (io.WriteCloser, error)
+	// Open opens name for reading, the error wraps os.ErrNotExist when it does not exist
+	Open(name string) (io.ReadCloser, error)
+	// WriteFile replaces name with data atomically
+	WriteFile(name string, data []byte) error
+	// ReadFile reads name, the error wraps os.ErrNotExist when it does not exist
+	ReadFile(name string) ([]byte, error)
+	// List returns the names of the files stored
+	List() ([]string, error)
+	// Remove deletes name, it does not fail when name does not exist
+	Remove(name string) error
+	// Sub returns the storage of a sub-folder, creating it when needed
+	Sub(name string) (storage, error)
+	// String describes the storage location for logs
+	String() string
+}
+
+// newStorage accepts a local folder path, a s3://bucket/prefix URL or - for stdout and stdin
+func newStorage(ctx context.Context, rawURL string) (storage, error) {
+	switch {
+	case rawURL == stdioStorageURL:
+		return &stdioStorage{}, nil
+	case strings.HasPrefix(rawURL, "s3://"):
+		return newS3Storage(ctx, rawURL)
+	case strings.HasPrefix(rawURL, "file://"):
+		return &localStorage{folderPath: strings.TrimPrefix(rawURL, "file://")}, nil
+	}
+
+	return &localStorage{folderPath: rawURL}, nil
+}
+
+// isResumableStorage reports whether files can be reopened and truncated, which checkpoints rely on
+func isResumableStorage(st storage) bool {
+	_, ok := st.(*localStorage)
+	return ok
+}
+
+type localStorage struct {
+	folderPath string
+}
+
+func (s *localStorage) path(name string) string {
+	return filepath.Join(s.folderPath, name)
+}
+
+func (s *localStorage) Create(name string) (io.WriteCloser, error) {
+	return os.Create(s.path(name))
+}
+
+func (s *localStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.path(name))
+}
+
+// WriteFile writes to a temporary file first so that a crash never leaves a truncated file behind
+func (s *localStorage) WriteFile(name string, data []byte) error {
+	if err := os.WriteFile(s.path(name)+".tmp", data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(s.path(name)+".tmp", s.path(name))
+}
+
+func (s *localStorage) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(s.path(name))
+}
+
+func (s *localStorage) List() ([]string, error) {
+	entries, err := os.ReadDir(s.folderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+func (s *localStorage) Remove(name string) error {
+	err := os.Remove(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *localStorage) Sub(name string) (storage, error) {
+	if err := os.MkdirAll(s.path(name), 0o755); err != nil {
+		return nil, err
+	}
+
+	return &localStorage{folderPath: s.path(name)}, nil
+}
+
+func (s *localStorage) String() string {
+	return s.folderPath
+}
+
+// s3Storage stores files as objects under a prefix of a S3-compatible bucket
+type s3Storage struct {
+	ctx    context.Context
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Storage(ctx context.Context, rawURL string) (*s3Storage, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid s3 URL: %s", rawURL)
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	if config.StorageS3AccessKeyID() != "" {
+		creds = credentials.NewStaticV4(config.StorageS3AccessKeyID(), config.StorageS3SecretAccessKey(), "")
+	}
+
+	client, err := minio.New(config.StorageS3Endpoint(), &minio.Options{
+		Creds:        creds,
+		Secure:       !config.StorageS3DisableSSL(),
+		Region:       config.StorageS3Region(),
+		BucketLookup: s3BucketLookup(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(parsedURL.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Storage{
+		ctx:    ctx,
+		client: client,
+		bucket: parsedURL.Host,
+		prefix: prefix,
+	}, nil
+}
+
+func s3BucketLookup() minio.BucketLookupType {
+	if config.StorageS3ForcePathStyle() {
+		return minio.BucketLookupPath
+	}
+
+	return minio.BucketLookupAuto
+}
+
+// s3Writer uploads what is written to it while it is being written, through a pipe
+type s3Writer struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	if err := w.pipe.Close(); err != nil {
+		return err
+	}
+
+	return <-w.done
+}
+
+func (s *s3Storage) Create(name string) (io.WriteCloser, error) {
+	reader, writer := io.Pipe()
+	w := &s3Writer{pipe: writer, done: make(chan error, 1)}
+
+	go func() {
+		_, err := s.client.PutObject(s.ctx, s.bucket, s.prefix+name, reader, -1, minio.PutObjectOptions{})
+		_ = reader.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+func (s *s3Storage) Open(name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(s.ctx, s.bucket, s.prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError(name, err)
+	}
+
+	// GetObject is lazy, stat it to report missing objects right away
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, s.wrapError(name, err)
+	}
+
+	return object, nil
+}
+
+func (s *s3Storage) WriteFile(name string, data []byte) error {
+	_, err := s.client.PutObject(s.ctx, s.bucket, s.prefix+name, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	return err
+}
+
+func (s *s3Storage) ReadFile(name string) ([]byte, error) {
+	object, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+func (s *s3Storage) List() ([]string, error) {
+	var names []string
+	for object := range s.client.ListObjects(s.ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		name := strings.TrimPrefix(object.Key, s.prefix)
+		if name != "" && !strings.HasSuffix(name, "/") {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (s *s3Storage) Remove(name string) error {
+	return s.client.RemoveObject(s.ctx, s.bucket, s.prefix+name, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Storage) Sub(name string) (storage, error) {
+	return &s3Storage{
+		ctx:    s.ctx,
+		client: s.client,
+		bucket: s.bucket,
+		prefix: s.prefix + name + "/",
+	}, nil
+}
+
+func (s *s3Storage) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+func (s *s3Storage) wrapError(name string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%s: %w", s.prefix+name, os.ErrNotExist)
+	}
+
+	return err
+}
+
+// stdioStorage streams the documents to stdout during backup and reads them from stdin during restore.
+// Only documents go through it, the other files such as the schema and the manifest are skipped.
+type stdioStorage struct{}
+
+// stdioFileName is the single file listed when restoring from stdin
+const stdioFileName = "-"
+
+func (s *stdioStorage) Create(name string) (io.WriteCloser, error) {
+	return nopWriteCloser{Writer: os.Stdout}, nil
+}
+
+func (s *stdioStorage) Open(name string) (io.ReadCloser, error) {
+	if name != stdioFileName {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+
+	return io.NopCloser(os.Stdin), nil
+}
+
+func (s *stdioStorage) WriteFile(_ string, _ []byte) error {
+	return nil
+}
+
+func (s *stdioStorage) ReadFile(name string) ([]byte, error) {
+	return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+}
+
+func (s *stdioStorage) List() ([]string, error) {
+	return []string{stdioFileName}, nil
+}
+
+func (s *stdioStorage) Remove(_ string) error {
+	return nil
+}
+
+func (s *stdioStorage) Sub(_ string) (storage, error) {
+	return nil, fmt.Errorf("sub-folders are not supported by %s", s)
+}
+
+func (s *stdioStorage) String() string {
+	return "stdio"
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// promptOutput returns where the config summary and confirmation prompt are printed, which is stderr together with
+// the logs when the documents are streamed to stdout
+func promptOutput(st storage) io.Writer {
+	if _, ok := st.(*stdioStorage); ok {
+		log.SetOutput(os.Stderr)
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// promptInput returns where the confirmation is read from, which is the terminal when the documents are streamed from stdin
+func promptInput(st storage) (io.ReadCloser, error) {
+	if _, ok := st.(*stdioStorage); ok {
+		return os.Open("/dev/tty")
+	}
+
+	return io.NopCloser(os.Stdin), nil
+}
+
+// confirmProceedWithStorage asks for confirmation on promptInput, which is not opened when --yes is set, so that
+// documents streamed from stdin can be restored without a terminal
+func confirmProceedWithStorage(st storage) (bool, error) {
+	if config.AssumeYes() {
+		return confirmProceed(os.Stdout, nil), nil
+	}
+
+	input, err := promptInput(st)
+	if err != nil {
+		return false, err
+	}
+	defer input.Close()
+
+	return confirmProceed(os.Stdout, input), nil
+}
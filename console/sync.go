@@ -0,0 +1,290 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"typesense-migration-tools/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "keep typesense collections in sync",
+	Long:  `This subcommand copy a typesense collection once, then keep upserting the documents changed since the last poll`,
+	Run:   runSync,
+}
+
+func init() {
+	addMigrationFlags(syncCmd)
+	addStringFlag(syncCmd, "timestamp-field", "migration.sync.timestamp_field")
+	addDurationFlag(syncCmd, "poll-interval", "migration.sync.poll_interval")
+	addStringFlag(syncCmd, "state-file-path", "migration.sync.state_file_path")
+	RootCmd.AddCommand(syncCmd)
+}
+
+func runSync(_ *cobra.Command, _ []string) {
+	err := validateSyncConfig()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	state, err := loadSyncState(config.MigrationSyncStateFilePath())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fmt.Printf("Source Typesense Host: %s\n", config.MigrationSourceTypesenseHost())
+	fmt.Printf("Source Typesense API Key: %s\n", maskSecret(config.MigrationSourceTypesenseAPIKey()))
+	fmt.Printf("Source Collection Name: %s\n", config.MigrationSourceCollection())
+	fmt.Printf("Destination Typesense Host: %s\n", config.MigrationDestinationTypesenseHost())
+	fmt.Printf("Destination Typesense API Key: %s\n", maskSecret(config.MigrationDestinationTypesenseAPIKey()))
+	fmt.Printf("Destination Collection Name: %s\n", config.MigrationDestinationCollection())
+	fmt.Printf("Filter: %s\n", config.MigrationFilter())
+	fmt.Printf("Timestamp Field: %s\n", config.MigrationSyncTimestampField())
+	fmt.Printf("Watermark: %s\n", syncWatermarkDescription(state))
+	fmt.Printf("Poll Interval: %s\n", config.MigrationSyncPollInterval())
+	fmt.Printf("State File Path: %s\n", config.MigrationSyncStateFilePath())
+	fmt.Printf("Reconcile Interval: %s\n", config.MigrationSyncReconcileInterval())
+	fmt.Printf("Reconcile Dry Run: %t\n", config.MigrationSyncReconcileDryRun())
+	fmt.Printf("Reconcile Max Deletions: %d\n", config.MigrationSyncReconcileMaxDeletions())
+	fmt.Printf("Batch Size: %d\n", config.MigrationBatchSize())
+	fmt.Printf("Workers: %d\n", config.MigrationWorkers())
+	fmt.Printf("Create Destination Collection: %t\n", config.MigrationDestinationCreateCollection())
+	fmt.Printf("Transforms: %d\n", len(config.MigrationTransforms()))
+	fmt.Printf("Transform Script: %s\n", config.MigrationTransformScript())
+	if !confirmProceed(os.Stdout, os.Stdin) {
+		log.Println("Sync operation cancelled.")
+		return
+	}
+
+	sourceTypesenseClient, destinationTypesenseClient, err := newMigrationClients()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	var (
+		ctx           = context.TODO()
+		importResults = newImportResultTracker(config.MigrationRejectedFilePath(), config.MigrationMaxFailureRatio())
+	)
+	defer importResults.Close()
+
+	if config.MigrationDestinationCreateCollection() {
+		if err := ensureMigrationDestinationCollection(ctx, sourceTypesenseClient, destinationTypesenseClient); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	var (
+		job           = newMigrationJob(sourceTypesenseClient, destinationTypesenseClient, importResults)
+		reconciler    = newSyncReconciliation(sourceTypesenseClient, destinationTypesenseClient)
+		lastReconcile time.Time
+	)
+	for {
+		if err := syncOnce(ctx, job, state); err != nil {
+			log.Error(err)
+			return
+		}
+
+		if config.MigrationSyncReconcileInterval() > 0 && time.Since(lastReconcile) >= config.MigrationSyncReconcileInterval() {
+			if err := reconcileOnce(ctx, reconciler); err != nil {
+				log.Error(err)
+				return
+			}
+			lastReconcile = time.Now()
+		}
+
+		time.Sleep(config.MigrationSyncPollInterval())
+	}
+}
+
+// syncOnce upserts the documents whose timestamp is at or above the watermark, every document on the first run, and
+// then moves the watermark to the highest timestamp seen before copying. Documents written while copying therefore
+// have a timestamp at or above the new watermark and are picked up by the next poll. The copy runs even when the
+// highest timestamp did not move, since a document written after the last poll may share the watermark value.
+func syncOnce(ctx context.Context, template *migrationJob, state *syncState) error {
+	field := config.MigrationSyncTimestampField()
+
+	if state.Watermark == "" {
+		log.Printf("Copying every document of %s", template.sourceCollection)
+	} else {
+		log.Printf("Syncing documents with %s:>=%s", field, state.Watermark)
+	}
+
+	next, err := copyFromWatermark(ctx, template, field, state.Watermark)
+	switch {
+	case err != nil:
+		return err
+	case next == "":
+		log.Printf("No documents to sync in %s", template.sourceCollection)
+		return nil
+	}
+
+	if err := state.advance(next); err != nil {
+		return err
+	}
+
+	log.Printf("Documents successfully synced from %s to %s up to %s:%s", template.sourceCollection, template.destinationCollection, field, next)
+
+	return nil
+}
+
+// copyFromWatermark runs the job on the documents whose field is at or above the watermark, every document when it is
+// empty, and returns the highest value of the field seen before copying, or an empty number when there are no
+// documents. It pages with a cursor on the field rather than page numbers, since a document updated while copying
+// moves to the end of the results and would shift every later page back, leaving the document at the next page
+// boundary behind.
+func copyFromWatermark(ctx context.Context, template *migrationJob, field string, watermark json.Number) (json.Number, error) {
+	next, err := fetchMaxTimestamp(ctx, template.sourceClient, template.sourceCollection, template.filter, field)
+	if err != nil || next == "" {
+		return next, err
+	}
+
+	job := *template
+	job.cursorField = field
+	job.cursorStart = watermark
+
+	return next, job.run(ctx)
+}
+
+func newSyncReconciliation(sourceClient, destinationClient typesense.APIClientInterface) *reconciliation {
+	return &reconciliation{
+		sourceClient:          sourceClient,
+		destinationClient:     destinationClient,
+		sourceCollection:      config.MigrationSourceCollection(),
+		destinationCollection: config.MigrationDestinationCollection(),
+		filter:                config.MigrationFilter(),
+		batchSize:             config.MigrationBatchSize(),
+		sleepInterval:         config.MigrationSleepInterval(),
+		maxDeletions:          config.MigrationSyncReconcileMaxDeletions(),
+		dryRun:                config.MigrationSyncReconcileDryRun(),
+	}
+}
+
+func reconcileOnce(ctx context.Context, reconciler *reconciliation) error {
+	log.Printf("Reconciling the ids of %s with %s", reconciler.destinationCollection, reconciler.sourceCollection)
+
+	ids, err := reconciler.run(ctx)
+	switch {
+	case err != nil:
+		return err
+	case len(ids) == 0:
+		log.Printf("No documents of %s are missing from %s", reconciler.destinationCollection, reconciler.sourceCollection)
+	case reconciler.dryRun:
+		log.Printf("Dry run, %d documents of %s would be deleted: %q", len(ids), reconciler.destinationCollection, ids)
+	default:
+		log.Printf("%d documents missing from %s successfully deleted from %s", len(ids), reconciler.sourceCollection, reconciler.destinationCollection)
+	}
+
+	return nil
+}
+
+// fetchMaxTimestamp returns the highest value of the timestamp field among the documents matching filter, or an empty
+// number when there are none. Numbers are decoded as json.Number since nanosecond timestamps exceed float64 precision.
+func fetchMaxTimestamp(ctx context.Context, client typesense.APIClientInterface, collection, filter, field string) (json.Number, error) {
+	searchParams := &typesenseAPI.SearchCollectionParams{
+		Q:             typesensePtr.String("*"),
+		SortBy:        typesensePtr.String(field + ":desc"),
+		PerPage:       typesensePtr.Int(1),
+		IncludeFields: typesensePtr.String(field),
+	}
+	if filter != "" {
+		searchParams.FilterBy = typesensePtr.String(filter)
+	}
+
+	resp, err := client.SearchCollection(ctx, collection, searchParams)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", dumpTypesenseHTTPResponseError(resp)
+	}
+
+	var result struct {
+		Hits []struct {
+			Document map[string]any `json:"document"`
+		} `json:"hits"`
+	}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return "", err
+	}
+
+	if len(result.Hits) == 0 {
+		return "", nil
+	}
+
+	value, ok := result.Hits[0].Document[field].(json.Number)
+	if !ok {
+		return "", fmt.Errorf("field %s of collection %s must be numeric, got %v", field, collection, result.Hits[0].Document[field])
+	}
+
+	return value, nil
+}
+
+// joinFilters combines the non-empty filter_by expressions with &&
+func joinFilters(filters ...string) string {
+	var parts []string
+	for _, filter := range filters {
+		if filter != "" {
+			parts = append(parts, filter)
+		}
+	}
+
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	for i, part := range parts {
+		parts[i] = "(" + part + ")"
+	}
+
+	return strings.Join(parts, " && ")
+}
+
+func syncWatermarkDescription(state *syncState) string {
+	if state.Watermark == "" {
+		return "none, every document is copied first"
+	}
+
+	return fmt.Sprintf("%s (updated at %s)", state.Watermark, state.UpdatedAt.Format(time.RFC3339))
+}
+
+func validateSyncConfig() error {
+	if err := validateMigrationCommonConfig(); err != nil {
+		return err
+	}
+
+	switch {
+	case config.MigrationSyncTimestampField() == "":
+		return fmt.Errorf("migration.sync.timestamp_field cannot be empty")
+	case config.MigrationSyncPollInterval() <= 0:
+		return fmt.Errorf("migration.sync.poll_interval must be a positive duration")
+	case config.MigrationSyncReconcileInterval() < 0:
+		return fmt.Errorf("migration.sync.reconcile.interval cannot be negative")
+	case config.MigrationSyncReconcileMaxDeletions() < 0:
+		return fmt.Errorf("migration.sync.reconcile.max_deletions cannot be negative")
+	}
+
+	if err := validateReconcileConfig(); err != nil {
+		return err
+	}
+
+	return validateCursorField("migration.sync.timestamp_field", config.MigrationSyncTimestampField(), config.MigrationIncludedFields(), config.MigrationExcludedFields())
+}
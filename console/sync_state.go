@@ -0,0 +1,78 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"typesense-migration-tools/config"
+)
+
+// syncState records the timestamp watermark reached by sync: every document of the source collection whose timestamp
+// field is below it has been upserted into the destination collection. An empty watermark means the initial copy is
+// still to be done.
+type syncState struct {
+	SourceCollection      string      `json:"source_collection"`
+	DestinationCollection string      `json:"destination_collection"`
+	TimestampField        string      `json:"timestamp_field"`
+	Watermark             json.Number `json:"watermark,omitempty"`
+	UpdatedAt             time.Time   `json:"updated_at"`
+
+	storage  storage
+	fileName string
+}
+
+func newSyncState(filePath string) *syncState {
+	return &syncState{
+		SourceCollection:      config.MigrationSourceCollection(),
+		DestinationCollection: config.MigrationDestinationCollection(),
+		TimestampField:        config.MigrationSyncTimestampField(),
+		storage:               &localStorage{folderPath: filepath.Dir(filePath)},
+		fileName:              filepath.Base(filePath),
+	}
+}
+
+func (s *syncState) advance(watermark json.Number) error {
+	s.Watermark = watermark
+	return s.save()
+}
+
+func (s *syncState) save() error {
+	s.UpdatedAt = time.Now().UTC()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.storage.WriteFile(s.fileName, b)
+}
+
+// loadSyncState reads the state file, or returns a new state when it does not exist. A state written for other
+// collections or another timestamp field is refused rather than silently reused.
+func loadSyncState(filePath string) (*syncState, error) {
+	state := newSyncState(filePath)
+
+	b, err := state.storage.ReadFile(state.fileName)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return state, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filePath, err)
+	}
+
+	if state.SourceCollection != config.MigrationSourceCollection() ||
+		state.DestinationCollection != config.MigrationDestinationCollection() ||
+		state.TimestampField != config.MigrationSyncTimestampField() {
+		return nil, fmt.Errorf("%s belongs to the sync of %s.%s into %s, remove it to start over",
+			filePath, state.SourceCollection, state.TimestampField, state.DestinationCollection)
+	}
+
+	return state, nil
+}
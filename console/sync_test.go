@@ -0,0 +1,182 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinFilters(t *testing.T) {
+	assert.Equal(t, "", joinFilters("", ""))
+	assert.Equal(t, "updated_at:>=10", joinFilters("", "updated_at:>=10"))
+	assert.Equal(t, "(status:=published || views:>10) && (updated_at:>=10)", joinFilters("status:=published || views:>10", "updated_at:>=10"))
+}
+
+// fakeSyncServer serves the search and import endpoints of Typesense used by sync, over documents keyed by id with
+// their updated_at timestamp. Searches are sorted on updated_at then id and honor the filters written by the keyset
+// cursor.
+type fakeSyncServer struct {
+	mu       sync.Mutex
+	docs     map[string]int64
+	imported []string
+	searched int
+	// afterSearch runs after each ascending search, to change documents while a copy runs
+	afterSearch func(s *fakeSyncServer)
+}
+
+var (
+	fakeMinTimestampPattern = regexp.MustCompile(`updated_at:>=(\d+)`)
+	fakeExcludedIDsPattern  = regexp.MustCompile(`id:!=\[([^\]]*)\]`)
+)
+
+func (s *fakeSyncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/documents/import") {
+		s.importDocuments(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	hits := s.search(query.Get("filter_by"), query.Get("sort_by") == "updated_at:desc")
+	found := len(hits)
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	page, _ := strconv.Atoi(query.Get("page"))
+	hits = hits[min((max(page, 1)-1)*perPage, len(hits)):min(max(page, 1)*perPage, len(hits))]
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"found": found, "hits": hits})
+
+	if query.Get("sort_by") == "updated_at:asc" && s.afterSearch != nil {
+		s.searched++
+		s.afterSearch(s)
+	}
+}
+
+func (s *fakeSyncServer) search(filter string, descending bool) []map[string]any {
+	var minTimestamp int64
+	if match := fakeMinTimestampPattern.FindStringSubmatch(filter); match != nil {
+		minTimestamp, _ = strconv.ParseInt(match[1], 10, 64)
+	}
+	excluded := map[string]bool{}
+	if match := fakeExcludedIDsPattern.FindStringSubmatch(filter); match != nil {
+		for _, id := range strings.Split(match[1], ",") {
+			excluded[strings.Trim(id, "`")] = true
+		}
+	}
+
+	var ids []string
+	for id, timestamp := range s.docs {
+		if timestamp >= minTimestamp && !excluded[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if s.docs[ids[i]] != s.docs[ids[j]] {
+			return (s.docs[ids[i]] < s.docs[ids[j]]) != descending
+		}
+		return ids[i] < ids[j]
+	})
+
+	hits := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		hits = append(hits, map[string]any{"document": map[string]any{"id": id, "updated_at": s.docs[id]}})
+	}
+
+	return hits
+}
+
+func (s *fakeSyncServer) importDocuments(w http.ResponseWriter, r *http.Request) {
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var doc struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(scanner.Bytes(), &doc)
+		s.imported = append(s.imported, doc.ID)
+		_, _ = w.Write([]byte("{\"success\":true}\n"))
+	}
+}
+
+func TestSyncOnceCopiesDocumentsUpdatedDuringTheCopy(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("migration.sync.timestamp_field", "updated_at")
+
+	fake := &fakeSyncServer{
+		docs: map[string]int64{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6},
+		// a is updated once the first page is read: it moves to the end of the results, which shifts every later page
+		// of a copy by page numbers back by one
+		afterSearch: func(s *fakeSyncServer) {
+			if s.searched == 1 {
+				s.docs["a"] = 100
+			}
+		},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := newTypesenseClient(config.TypesenseConnection{Host: server.URL, APIKey: "key", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	job := &migrationJob{
+		sourceClient:          client,
+		destinationClient:     client,
+		sourceCollection:      "articles",
+		destinationCollection: "articles_copy",
+		batchSize:             2,
+		workers:               1,
+		importResults:         newImportResultTracker(filepath.Join(t.TempDir(), "rejected.jsonl"), 0),
+	}
+	state := newSyncState(filepath.Join(t.TempDir(), "sync_state.json"))
+
+	require.NoError(t, syncOnce(context.Background(), job, state))
+
+	assert.Subset(t, fake.imported, []string{"a", "b", "c", "d", "e", "f"})
+	assert.Equal(t, json.Number("6"), state.Watermark)
+}
+
+func TestSyncOnceCopiesDocumentsSharingTheWatermark(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("migration.sync.timestamp_field", "updated_at")
+
+	fake := &fakeSyncServer{docs: map[string]int64{"a": 1, "b": 2}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := newTypesenseClient(config.TypesenseConnection{Host: server.URL, APIKey: "key", Timeout: 5 * time.Second})
+	require.NoError(t, err)
+	job := &migrationJob{
+		sourceClient:          client,
+		destinationClient:     client,
+		sourceCollection:      "articles",
+		destinationCollection: "articles_copy",
+		batchSize:             10,
+		workers:               1,
+		importResults:         newImportResultTracker(filepath.Join(t.TempDir(), "rejected.jsonl"), 0),
+	}
+	state := newSyncState(filepath.Join(t.TempDir(), "sync_state.json"))
+	require.NoError(t, syncOnce(context.Background(), job, state))
+
+	// c is written after the poll within the same second as b, the highest timestamp does not move
+	fake.docs["c"] = 2
+	fake.imported = nil
+	require.NoError(t, syncOnce(context.Background(), job, state))
+
+	assert.ElementsMatch(t, []string{"b", "c"}, fake.imported)
+	assert.Equal(t, json.Number("2"), state.Watermark)
+}
@@ -0,0 +1,54 @@
+package console
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"typesense-migration-tools/config"
+)
+
+// newTLSConfig returns the TLS config of a Typesense connection, the certificate of the server is verified against
+// the system roots, or against the CA of tls.ca_file when set
+func newTLSConfig(settings config.TLSSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: settings.InsecureSkipVerify, //nolint:gosec // opt-in, for clusters with self-signed certificates
+		ServerName:         settings.ServerName,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if settings.CAFile != "" {
+		caCertificates, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.ca_file: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertificates) {
+			return nil, fmt.Errorf("tls.ca_file: no PEM certificate found in %s", settings.CAFile)
+		}
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.cert_file and tls.key_file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// validateTLSSettings loads the CA and client certificate of the connection of a config section, so that a missing or
+// invalid file is reported before the confirmation prompt rather than once the command runs
+func validateTLSSettings(section, cluster string, settings config.TLSSettings) error {
+	if _, err := newTLSConfig(settings); err != nil {
+		if cluster != "" {
+			return fmt.Errorf("clusters.%s.%w", cluster, err)
+		}
+		return fmt.Errorf("%s.typesense.%w", section, err)
+	}
+
+	return nil
+}
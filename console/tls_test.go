@@ -0,0 +1,145 @@
+package console
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"typesense-migration-tools/config"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClientTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newTestCertificate(t, nil, nil, "test-ca", nil)
+	serverCert, serverKey := newTestCertificate(t, ca, caKey, "typesense.internal", []net.IP{net.ParseIP("127.0.0.1")})
+	clientCert, clientKey := newTestCertificate(t, ca, caKey, "backup", nil)
+	caFile := writeTestPEM(t, dir, "ca.pem", "CERTIFICATE", ca.Raw)
+	clientCertFile := writeTestPEM(t, dir, "client.pem", "CERTIFICATE", clientCert.Raw)
+	clientKeyFile := writeTestKey(t, dir, "client-key.pem", clientKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	get := func(settings config.TLSSettings) error {
+		client, err := newHTTPClient(config.TypesenseConnection{Timeout: 5 * time.Second, TLSHandshakeTimeout: 5 * time.Second, TLS: settings})
+		require.NoError(t, err)
+
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		return err
+	}
+
+	t.Run("verify the server certificate by default", func(t *testing.T) {
+		assert.ErrorContains(t, get(config.TLSSettings{}), "certificate")
+	})
+
+	t.Run("connect with the custom CA and a client certificate", func(t *testing.T) {
+		assert.NoError(t, get(config.TLSSettings{CAFile: caFile, CertFile: clientCertFile, KeyFile: clientKeyFile}))
+	})
+
+	t.Run("verify the certificate against the server name", func(t *testing.T) {
+		assert.NoError(t, get(config.TLSSettings{CAFile: caFile, CertFile: clientCertFile, KeyFile: clientKeyFile, ServerName: "typesense.internal"}))
+		assert.ErrorContains(t, get(config.TLSSettings{CAFile: caFile, CertFile: clientCertFile, KeyFile: clientKeyFile, ServerName: "other.internal"}), "other.internal")
+	})
+
+	t.Run("reject an invalid CA file", func(t *testing.T) {
+		_, err := newHTTPClient(config.TypesenseConnection{TLS: config.TLSSettings{CAFile: clientKeyFile}})
+		assert.EqualError(t, err, "tls.ca_file: no PEM certificate found in "+clientKeyFile)
+	})
+}
+
+func TestValidateTLSSettings(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	caFile := filepath.Join(t.TempDir(), "missing-ca.pem")
+
+	t.Run("name the setting of the section", func(t *testing.T) {
+		viper.Set("backup.typesense.host", "https://typesense.internal:8108")
+		viper.Set("backup.typesense.api_key", "key")
+		viper.Set("backup.collection", "articles")
+		viper.Set("backup.folder_path", t.TempDir())
+		viper.Set("backup.typesense.tls.ca_file", caFile)
+
+		assert.ErrorContains(t, validateBackupConfig(), "backup.typesense.tls.ca_file: open "+caFile)
+	})
+
+	t.Run("name the setting of the cluster", func(t *testing.T) {
+		err := validateTLSSettings("backup", "prod", config.TLSSettings{CertFile: caFile, KeyFile: caFile})
+		assert.ErrorContains(t, err, "clusters.prod.tls.cert_file and tls.key_file: open "+caFile)
+	})
+
+	t.Run("accept valid settings", func(t *testing.T) {
+		assert.NoError(t, validateTLSSettings("backup", "", config.TLSSettings{ServerName: "typesense.internal"}))
+	})
+}
+
+// newTestCertificate returns a certificate signed by parent, or a self-signed CA when parent is nil
+func newTestCertificate(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, commonName string, ips []net.IP) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return certificate, key
+}
+
+func writeTestPEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	fileName := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+
+	return fileName
+}
+
+func writeTestKey(t *testing.T, dir, name string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return writeTestPEM(t, dir, name, "EC PRIVATE KEY", der)
+}
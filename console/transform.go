@@ -0,0 +1,324 @@
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"typesense-migration-tools/config"
+)
+
+// documentTransform changes a document in place, an error rejects the document
+type documentTransform func(doc map[string]any) error
+
+// documentTransformer applies the declarative transforms and then the transform script to the documents before they are imported
+type documentTransformer struct {
+	transforms []documentTransform
+	script     *scriptTransform
+}
+
+func newDocumentTransformer(rules []config.Transform, scriptPath string) (*documentTransformer, error) {
+	transforms, err := newDocumentTransforms(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	transformer := &documentTransformer{transforms: transforms}
+	if scriptPath != "" {
+		if transformer.script, err = newScriptTransform(scriptPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return transformer, nil
+}
+
+// isEmpty reports whether documents go through untouched
+func (t *documentTransformer) isEmpty() bool {
+	return len(t.transforms) == 0 && t.script == nil
+}
+
+// transform returns the documents replacing doc, which may be none when the script skips it or several when it fans out
+func (t *documentTransformer) transform(doc map[string]any) ([]map[string]any, error) {
+	if err := applyDocumentTransforms(t.transforms, doc); err != nil {
+		return nil, err
+	}
+
+	if t.script == nil {
+		return []map[string]any{doc}, nil
+	}
+
+	return t.script.apply(doc)
+}
+
+// encode writes the transformed documents to buf as JSONL and returns how many were written. A document failing to
+// transform is written as original to the dead-letter file instead.
+func (t *documentTransformer) encode(buf *bytes.Buffer, doc map[string]any, original []byte, importResults *importResultTracker) (int, error) {
+	docs, err := t.transform(doc)
+	if err != nil {
+		return 0, importResults.reject(original, err)
+	}
+
+	for _, transformed := range docs {
+		b, err := json.Marshal(transformed)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	return len(docs), nil
+}
+
+// newDocumentTransforms validates the rules and turns them into transforms, to be applied in the same order
+func newDocumentTransforms(rules []config.Transform) ([]documentTransform, error) {
+	transforms := make([]documentTransform, 0, len(rules))
+	for i, rule := range rules {
+		transform, err := newDocumentTransform(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform %d (%s): %w", i+1, rule.Type, err)
+		}
+		transforms = append(transforms, transform)
+	}
+
+	return transforms, nil
+}
+
+func newDocumentTransform(rule config.Transform) (documentTransform, error) {
+	if rule.Field == "" {
+		return nil, fmt.Errorf("field cannot be empty")
+	}
+
+	switch rule.Type {
+	case config.TransformRename:
+		return renameTransform(rule)
+	case config.TransformDrop:
+		return dropTransform(rule), nil
+	case config.TransformSet:
+		return setTransform(rule), nil
+	case config.TransformCoerce:
+		return coerceTransform(rule)
+	case config.TransformSplit:
+		return splitTransform(rule), nil
+	case config.TransformJoin:
+		return joinTransform(rule), nil
+	case config.TransformDerive:
+		return deriveTransform(rule)
+	}
+
+	return nil, fmt.Errorf("unknown transform type, expected one of %s", strings.Join([]string{
+		config.TransformRename, config.TransformDrop, config.TransformSet, config.TransformCoerce,
+		config.TransformSplit, config.TransformJoin, config.TransformDerive,
+	}, ", "))
+}
+
+func applyDocumentTransforms(transforms []documentTransform, doc map[string]any) error {
+	for _, transform := range transforms {
+		if err := transform(doc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transformTarget is where split and join write their result, the transformed field itself by default
+func transformTarget(rule config.Transform) string {
+	if rule.To != "" {
+		return rule.To
+	}
+
+	return rule.Field
+}
+
+func renameTransform(rule config.Transform) (documentTransform, error) {
+	if rule.To == "" {
+		return nil, fmt.Errorf("to cannot be empty")
+	}
+
+	return func(doc map[string]any) error {
+		if value, ok := doc[rule.Field]; ok {
+			delete(doc, rule.Field)
+			doc[rule.To] = value
+		}
+		return nil
+	}, nil
+}
+
+func dropTransform(rule config.Transform) documentTransform {
+	return func(doc map[string]any) error {
+		delete(doc, rule.Field)
+		return nil
+	}
+}
+
+func setTransform(rule config.Transform) documentTransform {
+	return func(doc map[string]any) error {
+		doc[rule.Field] = rule.Value
+		return nil
+	}
+}
+
+func coerceTransform(rule config.Transform) (documentTransform, error) {
+	var coerce func(value any) (any, error)
+	switch rule.As {
+	case "int64":
+		coerce = coerceToInt64
+	case "float":
+		coerce = coerceToFloat
+	case "string":
+		coerce = func(value any) (any, error) { return coerceToString(value) }
+	case "string[]":
+		coerce = coerceToStringArray
+	default:
+		return nil, fmt.Errorf("as must be one of int64, float, string or string[]")
+	}
+
+	return func(doc map[string]any) error {
+		value, ok := doc[rule.Field]
+		if !ok || value == nil {
+			return nil
+		}
+
+		coerced, err := coerce(value)
+		if err != nil {
+			return fmt.Errorf("cannot coerce field %s to %s: %w", rule.Field, rule.As, err)
+		}
+		doc[rule.Field] = coerced
+
+		return nil
+	}, nil
+}
+
+func splitTransform(rule config.Transform) documentTransform {
+	return func(doc map[string]any) error {
+		value, ok := doc[rule.Field].(string)
+		if !ok {
+			return nil
+		}
+
+		parts := []string{}
+		for _, part := range strings.Split(value, rule.Separator) {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		doc[transformTarget(rule)] = parts
+
+		return nil
+	}
+}
+
+func joinTransform(rule config.Transform) documentTransform {
+	return func(doc map[string]any) error {
+		values, ok := doc[rule.Field].([]any)
+		if !ok {
+			return nil
+		}
+
+		parts := make([]string, 0, len(values))
+		for _, value := range values {
+			part, err := coerceToString(value)
+			if err != nil {
+				return fmt.Errorf("cannot join field %s: %w", rule.Field, err)
+			}
+			parts = append(parts, part)
+		}
+		doc[transformTarget(rule)] = strings.Join(parts, rule.Separator)
+
+		return nil
+	}
+}
+
+// deriveTransform renders a text/template with the document as data, e.g. `{{.first_name}} {{.last_name}}`
+func deriveTransform(rule config.Transform) (documentTransform, error) {
+	tmpl, err := template.New(rule.Field).Option("missingkey=error").Parse(rule.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(doc map[string]any) error {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, doc); err != nil {
+			return fmt.Errorf("cannot derive field %s: %w", rule.Field, err)
+		}
+		doc[rule.Field] = buf.String()
+
+		return nil
+	}, nil
+}
+
+// coerceToInt64 accepts numeric strings and whole numbers, JSON numbers being decoded as float64
+func coerceToInt64(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("%v is not a whole number", v)
+		}
+		return int64(v), nil
+	case int, int64, int32:
+		return v, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
+
+func coerceToFloat(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %v", value)
+}
+
+func coerceToString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int, int64, int32, bool:
+		return fmt.Sprint(v), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// coerceToStringArray wraps a single value into an array, and converts the items of an existing array to strings
+func coerceToStringArray(value any) (any, error) {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		s, err := coerceToString(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,79 @@
+package console
+
+import (
+	"encoding/json"
+	"testing"
+	"typesense-migration-tools/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentTransforms(t *testing.T) {
+	newDoc := func() map[string]any {
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"id": "1",
+			"first_name": "Ada",
+			"last_name": "Lovelace",
+			"views": "42",
+			"rating": 4,
+			"tags": "math, computing,",
+			"keywords": ["a", "b"],
+			"legacy": true
+		}`), &doc))
+		return doc
+	}
+
+	transforms, err := newDocumentTransforms([]config.Transform{
+		{Type: config.TransformRename, Field: "last_name", To: "surname"},
+		{Type: config.TransformDrop, Field: "legacy"},
+		{Type: config.TransformSet, Field: "source", Value: "v1"},
+		{Type: config.TransformCoerce, Field: "views", As: "int64"},
+		{Type: config.TransformCoerce, Field: "rating", As: "float"},
+		{Type: config.TransformCoerce, Field: "first_name", As: "string[]"},
+		{Type: config.TransformSplit, Field: "tags", Separator: ","},
+		{Type: config.TransformJoin, Field: "keywords", Separator: " ", To: "keywords_text"},
+		{Type: config.TransformDerive, Field: "display_name", Template: "{{index .first_name 0}} {{.surname}}"},
+	})
+	require.NoError(t, err)
+
+	t.Run("apply the rules in order", func(t *testing.T) {
+		doc := newDoc()
+		require.NoError(t, applyDocumentTransforms(transforms, doc))
+
+		assert.Equal(t, map[string]any{
+			"id":            "1",
+			"first_name":    []string{"Ada"},
+			"surname":       "Lovelace",
+			"views":         int64(42),
+			"rating":        float64(4),
+			"tags":          []string{"math", "computing"},
+			"keywords":      []any{"a", "b"},
+			"keywords_text": "a b",
+			"source":        "v1",
+			"display_name":  "Ada Lovelace",
+		}, doc)
+	})
+
+	t.Run("reject documents that can not be transformed", func(t *testing.T) {
+		doc := newDoc()
+		doc["views"] = "many"
+		assert.Error(t, applyDocumentTransforms(transforms, doc))
+
+		doc = newDoc()
+		delete(doc, "last_name")
+		assert.Error(t, applyDocumentTransforms(transforms, doc), "derive fails on a missing field")
+	})
+
+	t.Run("reject invalid rules", func(t *testing.T) {
+		_, err := newDocumentTransforms([]config.Transform{{Type: "uppercase", Field: "title"}})
+		assert.Error(t, err)
+
+		_, err = newDocumentTransforms([]config.Transform{{Type: config.TransformRename, Field: "title"}})
+		assert.Error(t, err)
+
+		_, err = newDocumentTransforms([]config.Transform{{Type: config.TransformCoerce, Field: "title", As: "bool"}})
+		assert.Error(t, err)
+	})
+}
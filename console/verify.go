@@ -0,0 +1,533 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"typesense-migration-tools/config"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/typesense/typesense-go/v2/typesense"
+	typesenseAPI "github.com/typesense/typesense-go/v2/typesense/api"
+	typesensePtr "github.com/typesense/typesense-go/v2/typesense/api/pointer"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify typesense documents",
+	Long:  `This subcommand compare the documents of a typesense collection with the documents of another collection or of a backup folder`,
+	Run:   runVerify,
+}
+
+func init() {
+	addTypesenseFlags(verifyCmd, "source-", "verify.source")
+	addTypesenseFlags(verifyCmd, "destination-", "verify.destination")
+	addStringFlag(verifyCmd, "source-collection", "verify.source.collection")
+	addStringFlag(verifyCmd, "source-folder-path", "verify.source.folder_path")
+	addStringFlag(verifyCmd, "destination-collection", "verify.destination.collection")
+	addStringFlag(verifyCmd, "filter", "verify.filter")
+	addStringFlag(verifyCmd, "report-file-path", "verify.report_file_path")
+	RootCmd.AddCommand(verifyCmd)
+}
+
+// documentSource streams the documents of a collection or a backup folder
+type documentSource interface {
+	forEach(ctx context.Context, fn func(doc map[string]any) error) error
+	// count returns -1 when the number of documents is not known beforehand
+	count(ctx context.Context) (int64, error)
+	String() string
+}
+
+func runVerify(_ *cobra.Command, _ []string) {
+	err := validateVerifyConfig()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fmt.Printf("Source Typesense Host: %s\n", config.VerifySourceTypesenseHost())
+	fmt.Printf("Source Typesense API Key: %s\n", maskSecret(config.VerifySourceTypesenseAPIKey()))
+	fmt.Printf("Source Collection Name: %s\n", config.VerifySourceCollection())
+	fmt.Printf("Source Folder Path: %s\n", config.VerifySourceFolderPath())
+	fmt.Printf("Destination Typesense Host: %s\n", config.VerifyDestinationTypesenseHost())
+	fmt.Printf("Destination Typesense API Key: %s\n", maskSecret(config.VerifyDestinationTypesenseAPIKey()))
+	fmt.Printf("Destination Collection Name: %s\n", config.VerifyDestinationCollection())
+	fmt.Printf("Filter: %s\n", config.VerifyFilter())
+	fmt.Printf("Included Fields: %s\n", strings.Join(config.VerifyIncludedFields(), ","))
+	fmt.Printf("Excluded Fields: %s\n", strings.Join(config.VerifyExcludedFields(), ","))
+	fmt.Printf("Transforms: %d\n", len(config.VerifyTransforms()))
+	fmt.Printf("Transform Script: %s\n", config.VerifyTransformScript())
+	fmt.Printf("Report File Path: %s\n", config.VerifyReportFilePath())
+	fmt.Printf("Sort Batch Size: %d\n", config.VerifySortBatchSize())
+	if !confirmProceed(os.Stdout, os.Stdin) {
+		log.Println("Verify operation cancelled.")
+		return
+	}
+
+	ctx := context.TODO()
+	source, err := newVerifySource(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	transformer, err := newDocumentTransformer(config.VerifyTransforms(), config.VerifyTransformScript())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	report, err := newVerifyReport(config.VerifyReportFilePath())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer report.Close()
+
+	destinationClient, err := newTypesenseClientWithTimeout(config.VerifyDestinationTypesenseConnection(), config.VerifyExportTimeout())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	v := &verifier{
+		source:         source,
+		destination:    &collectionSource{client: destinationClient, collection: config.VerifyDestinationCollection()},
+		transformer:    transformer,
+		includedFields: config.VerifyIncludedFields(),
+		excludedFields: config.VerifyExcludedFields(),
+		maxFieldDiffs:  config.VerifyMaxFieldDiffs(),
+		sortBatchSize:  config.VerifySortBatchSize(),
+		report:         report,
+	}
+	if err := v.run(ctx); err != nil {
+		log.Error(err)
+		return
+	}
+
+	v.logSummary()
+}
+
+func newVerifySource(ctx context.Context) (documentSource, error) {
+	if config.VerifySourceFolderPath() == "" {
+		client, err := newTypesenseClientWithTimeout(config.VerifySourceTypesenseConnection(), config.VerifyExportTimeout())
+		if err != nil {
+			return nil, err
+		}
+
+		return &collectionSource{
+			client:     client,
+			collection: config.VerifySourceCollection(),
+			filter:     config.VerifyFilter(),
+		}, nil
+	}
+
+	st, err := newStorage(ctx, config.VerifySourceFolderPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return &backupSource{storage: st}, nil
+}
+
+// verifier compares the expected documents, the source ones once transformed, with the destination ones. Typesense
+// cannot sort on id, so each side is sorted by id on disk, sortBatchSize documents at a time, and both sorted streams
+// are then walked side by side: memory is bounded by sortBatchSize whatever the size of the collections, and the
+// differing fields of the first maxFieldDiffs differing documents are taken from the documents at hand.
+type verifier struct {
+	source         documentSource
+	destination    documentSource
+	transformer    *documentTransformer
+	includedFields []string
+	excludedFields []string
+	maxFieldDiffs  int
+	sortBatchSize  int
+	report         *verifyReport
+
+	matching           int
+	detailed           int
+	rejectedTransforms int
+}
+
+func (v *verifier) run(ctx context.Context) error {
+	if err := v.compareCounts(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Sorting the documents of %s by id", v.source)
+	expected := newDocumentSorter(v.sortBatchSize)
+	defer expected.Close()
+	if err := v.forEachExpected(ctx, expected.add); err != nil {
+		return err
+	}
+
+	log.Printf("Sorting the documents of %s by id", v.destination)
+	actual := newDocumentSorter(v.sortBatchSize)
+	defer actual.Close()
+	err := v.destination.forEach(ctx, func(doc map[string]any) error {
+		projected := projectDocument(doc, v.includedFields, v.excludedFields)
+		id, _ := projected["id"].(string)
+		return actual.add(id, projected)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Comparing the documents of %s with %s", v.destination, v.source)
+
+	return v.compare(expected, actual)
+}
+
+// compareCounts only logs the counts, transforms and filters legitimately make them differ
+func (v *verifier) compareCounts(ctx context.Context) error {
+	sourceCount, err := v.source.count(ctx)
+	if err != nil {
+		return err
+	}
+
+	destinationCount, err := v.destination.count(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case sourceCount < 0:
+		log.Printf("%d documents in %s, the number of documents of %s is unknown", destinationCount, v.destination, v.source)
+	case sourceCount == destinationCount:
+		log.Printf("Document counts match: %d documents in %s and %s", sourceCount, v.source, v.destination)
+	default:
+		log.Warnf("document counts differ: %d documents in %s, %d in %s", sourceCount, v.source, destinationCount, v.destination)
+	}
+
+	return nil
+}
+
+// forEachExpected streams the source documents through the transforms and the field projection
+func (v *verifier) forEachExpected(ctx context.Context, fn func(id string, doc map[string]any) error) error {
+	v.rejectedTransforms = 0
+	return v.source.forEach(ctx, func(doc map[string]any) error {
+		docs, err := v.transformer.transform(doc)
+		if err != nil {
+			v.rejectedTransforms++
+			return nil
+		}
+
+		for _, transformed := range docs {
+			projected := projectDocument(transformed, v.includedFields, v.excludedFields)
+			id, _ := projected["id"].(string)
+			if err := fn(id, projected); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// compare walks both sides in id order: an id only expected is missing, an id only in the destination is extra
+func (v *verifier) compare(expectedSorter, actualSorter *documentSorter) error {
+	expectedDocs, err := expectedSorter.iterator()
+	if err != nil {
+		return err
+	}
+
+	actualDocs, err := actualSorter.iterator()
+	if err != nil {
+		return err
+	}
+
+	expected, err := expectedDocs.next()
+	if err != nil {
+		return err
+	}
+
+	actual, err := actualDocs.next()
+	if err != nil {
+		return err
+	}
+
+	for expected != nil || actual != nil {
+		switch {
+		case actual == nil || (expected != nil && expected.ID < actual.ID):
+			err = v.report.write(verifyReportEntry{ID: expected.ID, Status: verifyStatusMissing})
+			if err == nil {
+				expected, err = expectedDocs.next()
+			}
+		case expected == nil || actual.ID < expected.ID:
+			err = v.report.write(verifyReportEntry{ID: actual.ID, Status: verifyStatusExtra})
+			if err == nil {
+				actual, err = actualDocs.next()
+			}
+		default:
+			err = v.compareDocuments(expected, actual)
+			if err == nil {
+				expected, err = expectedDocs.next()
+			}
+			if err == nil {
+				actual, err = actualDocs.next()
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compareDocuments compares the hashes of two documents sharing an id, the differing fields are reported for the
+// first maxFieldDiffs differing documents
+func (v *verifier) compareDocuments(expected, actual *sortedDocument) error {
+	expectedHash, err := documentHash(expected.Doc)
+	if err != nil {
+		return err
+	}
+
+	actualHash, err := documentHash(actual.Doc)
+	switch {
+	case err != nil:
+		return err
+	case expectedHash == actualHash:
+		v.matching++
+		return nil
+	}
+
+	entry := verifyReportEntry{ID: expected.ID, Status: verifyStatusDifferent}
+	if v.detailed < v.maxFieldDiffs {
+		v.detailed++
+		if entry.Fields, err = diffDocumentFields(expected.Doc, actual.Doc); err != nil {
+			return err
+		}
+	}
+
+	return v.report.write(entry)
+}
+
+func (v *verifier) logSummary() {
+	summary := fmt.Sprintf("%d matching, %d missing, %d extra and %d different documents",
+		v.matching, v.report.counts[verifyStatusMissing], v.report.counts[verifyStatusExtra], v.report.counts[verifyStatusDifferent])
+
+	if v.rejectedTransforms > 0 {
+		log.Warnf("%d source documents failed the transforms and are not expected in %s", v.rejectedTransforms, v.destination)
+	}
+
+	if v.report.isClean() {
+		log.Printf("%s successfully verified against %s: %s", v.destination, v.source, summary)
+		return
+	}
+
+	log.Errorf("%s does not match %s: %s, see %s", v.destination, v.source, summary, config.VerifyReportFilePath())
+}
+
+// collectionSource streams the documents of a collection through the export endpoint
+type collectionSource struct {
+	client     typesense.APIClientInterface
+	collection string
+	filter     string
+}
+
+func (s *collectionSource) forEach(ctx context.Context, fn func(doc map[string]any) error) error {
+	return s.export(ctx, s.filter, fn)
+}
+
+func (s *collectionSource) export(ctx context.Context, filter string, fn func(doc map[string]any) error) error {
+	exportParams := &typesenseAPI.ExportDocumentsParams{}
+	if filter != "" {
+		exportParams.FilterBy = typesensePtr.String(filter)
+	}
+
+	resp, err := s.client.ExportDocuments(ctx, s.collection, exportParams)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return dumpTypesenseHTTPResponseError(resp)
+	}
+
+	return forEachJSONLine(resp.Body, fn)
+}
+
+func (s *collectionSource) count(ctx context.Context) (int64, error) {
+	if s.filter == "" {
+		return collectionDocumentCount(ctx, s.client, s.collection)
+	}
+
+	searchResult, err := s.client.SearchCollectionWithResponse(ctx, s.collection, &typesenseAPI.SearchCollectionParams{
+		Q:             typesensePtr.String("*"),
+		FilterBy:      typesensePtr.String(s.filter),
+		PerPage:       typesensePtr.Int(1),
+		IncludeFields: typesensePtr.String("id"),
+	})
+	switch {
+	case err != nil:
+		return 0, err
+	case isTypesenseErrorResponse(searchResult):
+		return 0, dumpTypesenseSearchResponseError(searchResult)
+	}
+
+	return int64(*searchResult.JSON200.Found), nil
+}
+
+func (s *collectionSource) String() string {
+	return s.collection
+}
+
+// backupSource streams the documents of the files of a backup folder
+type backupSource struct {
+	storage storage
+}
+
+func (s *backupSource) forEach(_ context.Context, fn func(doc map[string]any) error) error {
+	files, err := findBackupFiles(s.storage)
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range files {
+		if err := s.forEachInFile(fileName, fn); err != nil {
+			return fmt.Errorf("error reading file %s: %w", fileName, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *backupSource) forEachInFile(fileName string, fn func(doc map[string]any) error) error {
+	file, err := s.storage.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := newDecompressReader(fileName, file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return forEachJSONLine(reader, fn)
+}
+
+func (s *backupSource) count(_ context.Context) (int64, error) {
+	manifest, err := readManifestFile(s.storage)
+	switch {
+	case err != nil:
+		return 0, err
+	case manifest == nil:
+		return -1, nil
+	}
+
+	return int64(manifest.TotalDocuments), nil
+}
+
+func (s *backupSource) String() string {
+	return s.storage.String()
+}
+
+// forEachJSONLine decodes every non-empty line of r as a document, lines are not limited in length
+func forEachJSONLine(r io.Reader, fn func(doc map[string]any) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var doc map[string]any
+			if err := json.Unmarshal(line, &doc); err != nil {
+				return fmt.Errorf("invalid document %s: %w", string(line), err)
+			}
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+func validateVerifyConfig() error {
+	if err := validateVerifySourceConfig(); err != nil {
+		return err
+	}
+
+	if err := validateClusterReference("verify.destination", config.VerifyDestinationCluster()); err != nil {
+		return err
+	}
+
+	parsedURL, err := url.Parse(config.VerifyDestinationTypesenseHost())
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid destination typesense host URL: %s", config.VerifyDestinationTypesenseHost())
+	}
+
+	if err := validateTLSSettings("verify.destination", config.VerifyDestinationCluster(), config.VerifyDestinationTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
+	switch {
+	case config.VerifyDestinationTypesenseAPIKey() == "":
+		return fmt.Errorf("verify.destination.typesense.api_key cannot be empty")
+	case config.VerifyDestinationCollection() == "":
+		return fmt.Errorf("verify.destination.collection cannot be empty")
+	case config.VerifyMaxFieldDiffs() < 0:
+		return fmt.Errorf("verify.max_field_diffs cannot be negative")
+	case config.VerifySortBatchSize() <= 0:
+		return fmt.Errorf("verify.sort_batch_size must be a positive integer")
+	}
+
+	if _, err := newDocumentTransforms(config.VerifyTransforms()); err != nil {
+		return fmt.Errorf("verify.transforms: %w", err)
+	}
+
+	if _, err := newDocumentTransformer(nil, config.VerifyTransformScript()); err != nil {
+		return fmt.Errorf("verify.transform_script: %w", err)
+	}
+
+	return nil
+}
+
+func validateVerifySourceConfig() error {
+	switch {
+	case config.VerifySourceCollection() != "" && config.VerifySourceFolderPath() != "":
+		return fmt.Errorf("verify.source.collection and verify.source.folder_path cannot be both set")
+	case config.VerifySourceFolderPath() == stdioStorageURL:
+		return fmt.Errorf("verify.source.folder_path cannot be stdin")
+	case config.VerifySourceFolderPath() != "":
+		return nil
+	case config.VerifySourceCollection() == "":
+		return fmt.Errorf("either verify.source.collection or verify.source.folder_path must be set")
+	}
+
+	if err := validateClusterReference("verify.source", config.VerifySourceCluster()); err != nil {
+		return err
+	}
+
+	parsedURL, err := url.Parse(config.VerifySourceTypesenseHost())
+	if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid source typesense host URL: %s", config.VerifySourceTypesenseHost())
+	}
+
+	if err := validateTLSSettings("verify.source", config.VerifySourceCluster(), config.VerifySourceTypesenseConnection().TLS); err != nil {
+		return err
+	}
+
+	if config.VerifySourceTypesenseAPIKey() == "" {
+		return fmt.Errorf("verify.source.typesense.api_key cannot be empty")
+	}
+
+	return nil
+}
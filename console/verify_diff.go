@@ -0,0 +1,146 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+const (
+	verifyStatusMissing   = "missing"
+	verifyStatusExtra     = "extra"
+	verifyStatusDifferent = "different"
+)
+
+// fieldDiff holds the expected and actual values of a field, a side lacking the field leaves its value out
+type fieldDiff struct {
+	Expected any `json:"expected,omitempty"`
+	Actual   any `json:"actual,omitempty"`
+}
+
+// verifyReportEntry is a line of the verify report. Missing documents are expected but not in the destination, extra
+// documents are in the destination but not expected.
+type verifyReportEntry struct {
+	ID     string               `json:"id"`
+	Status string               `json:"status"`
+	Fields map[string]fieldDiff `json:"fields,omitempty"`
+}
+
+// verifyReport writes the report entries to a JSONL file and counts them by status
+type verifyReport struct {
+	file   *os.File
+	writer *bufio.Writer
+	counts map[string]int
+}
+
+func newVerifyReport(filePath string) (*verifyReport, error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifyReport{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		counts: make(map[string]int),
+	}, nil
+}
+
+func (r *verifyReport) write(entry verifyReportEntry) error {
+	r.counts[entry.Status]++
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.writer.Write(append(b, '\n'))
+	return err
+}
+
+// isClean reports whether no difference was written
+func (r *verifyReport) isClean() bool {
+	return len(r.counts) == 0
+}
+
+func (r *verifyReport) Close() error {
+	if err := r.writer.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+
+	return r.file.Close()
+}
+
+// projectDocument returns a copy of doc limited to the included fields, when any, without the excluded ones. The id
+// is always kept.
+func projectDocument(doc map[string]any, includedFields, excludedFields []string) map[string]any {
+	projected := make(map[string]any, len(doc))
+	if len(includedFields) == 0 {
+		for field, value := range doc {
+			projected[field] = value
+		}
+	} else {
+		for _, field := range append([]string{"id"}, includedFields...) {
+			if value, ok := doc[field]; ok {
+				projected[field] = value
+			}
+		}
+	}
+
+	for _, field := range excludedFields {
+		if field != "id" {
+			delete(projected, field)
+		}
+	}
+
+	return projected
+}
+
+// documentHash hashes the JSON encoding of doc, whose keys are sorted by encoding/json
+func documentHash(doc map[string]any) ([sha256.Size]byte, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	return sha256.Sum256(b), nil
+}
+
+// diffDocumentFields compares the JSON encoding of every field found on either side
+func diffDocumentFields(expected, actual map[string]any) (map[string]fieldDiff, error) {
+	fields := make(map[string]bool, len(expected))
+	for field := range expected {
+		fields[field] = true
+	}
+	for field := range actual {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	diffs := make(map[string]fieldDiff)
+	for _, field := range names {
+		expectedValue, err := json.Marshal(expected[field])
+		if err != nil {
+			return nil, err
+		}
+		actualValue, err := json.Marshal(actual[field])
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(expectedValue, actualValue) {
+			diffs[field] = fieldDiff{Expected: expected[field], Actual: actual[field]}
+		}
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,49 @@
+package console
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDiff(t *testing.T) {
+	t.Run("project the compared fields", func(t *testing.T) {
+		doc := map[string]any{"id": "1", "title": "a", "views": 3.0, "tags": []any{"x"}}
+
+		assert.Equal(t, map[string]any{"id": "1", "title": "a"}, projectDocument(doc, []string{"title"}, nil))
+		assert.Equal(t, map[string]any{"id": "1", "title": "a", "tags": []any{"x"}}, projectDocument(doc, nil, []string{"views", "id"}))
+		assert.Len(t, doc, 4)
+	})
+
+	t.Run("hash documents regardless of the field order", func(t *testing.T) {
+		var a, b map[string]any
+		require.NoError(t, json.Unmarshal([]byte(`{"id":"1","title":"a","views":3}`), &a))
+		require.NoError(t, json.Unmarshal([]byte(`{"views":3,"title":"a","id":"1"}`), &b))
+
+		hashA, err := documentHash(a)
+		require.NoError(t, err)
+		hashB, err := documentHash(b)
+		require.NoError(t, err)
+		assert.Equal(t, hashA, hashB)
+
+		b["views"] = 4.0
+		hashB, err = documentHash(b)
+		require.NoError(t, err)
+		assert.NotEqual(t, hashA, hashB)
+	})
+
+	t.Run("diff the fields of both sides", func(t *testing.T) {
+		diffs, err := diffDocumentFields(
+			map[string]any{"id": "1", "title": "a", "views": 3.0, "tags": []string{"x"}},
+			map[string]any{"id": "1", "title": "b", "tags": []any{"x"}, "extra": true},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]fieldDiff{
+			"title": {Expected: "a", Actual: "b"},
+			"views": {Expected: 3.0},
+			"extra": {Actual: true},
+		}, diffs)
+	})
+}
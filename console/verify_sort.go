@@ -0,0 +1,228 @@
+package console
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// sortedDocument is a document with its id, in the order it was added to a documentSorter
+type sortedDocument struct {
+	ID  string         `json:"id"`
+	Seq int            `json:"seq"`
+	Doc map[string]any `json:"doc"`
+}
+
+func (d *sortedDocument) before(other *sortedDocument) bool {
+	if d.ID != other.ID {
+		return d.ID < other.ID
+	}
+
+	return d.Seq < other.Seq
+}
+
+// documentSorter sorts documents by id with bounded memory: up to batchSize documents are held in memory, sorted and
+// written to a temporary run file once the batch is full, and the runs are merged while the documents are read back.
+type documentSorter struct {
+	batchSize int
+	batch     []sortedDocument
+	runs      []*os.File
+	seq       int
+}
+
+func newDocumentSorter(batchSize int) *documentSorter {
+	return &documentSorter{batchSize: batchSize}
+}
+
+func (s *documentSorter) add(id string, doc map[string]any) error {
+	s.batch = append(s.batch, sortedDocument{ID: id, Seq: s.seq, Doc: doc})
+	s.seq++
+
+	if len(s.batch) < s.batchSize {
+		return nil
+	}
+
+	return s.writeRun()
+}
+
+// writeRun sorts the batch into a new run file
+func (s *documentSorter) writeRun() error {
+	s.sortBatch()
+
+	file, err := os.CreateTemp("", "verify-run-*.jsonl")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file)
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for i := range s.batch {
+		if err := encoder.Encode(&s.batch[i]); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	s.batch = s.batch[:0]
+
+	return nil
+}
+
+func (s *documentSorter) sortBatch() {
+	sort.Slice(s.batch, func(i, j int) bool {
+		return s.batch[i].before(&s.batch[j])
+	})
+}
+
+// iterator returns the documents sorted by id. Of the documents sharing an id, only the last one added is returned,
+// like a restore of the same documents would keep.
+func (s *documentSorter) iterator() (*sortedDocumentIterator, error) {
+	var runs []documentRun
+	if len(s.runs) == 0 {
+		s.sortBatch()
+		runs = append(runs, &memoryRun{docs: s.batch})
+	} else {
+		if len(s.batch) > 0 {
+			if err := s.writeRun(); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, file := range s.runs {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			runs = append(runs, &fileRun{reader: bufio.NewReader(file)})
+		}
+	}
+
+	it := &sortedDocumentIterator{}
+	for _, run := range runs {
+		doc, err := run.next()
+		switch {
+		case err != nil:
+			return nil, err
+		case doc != nil:
+			it.runs = append(it.runs, &runHead{run: run, doc: doc})
+		}
+	}
+	heap.Init(&it.runs)
+
+	return it, nil
+}
+
+// Close removes the run files
+func (s *documentSorter) Close() error {
+	var errs []error
+	for _, file := range s.runs {
+		errs = append(errs, file.Close(), os.Remove(file.Name()))
+	}
+	s.runs = nil
+
+	return errors.Join(errs...)
+}
+
+// documentRun returns the documents of a sorted run one by one, nil once it is exhausted
+type documentRun interface {
+	next() (*sortedDocument, error)
+}
+
+type memoryRun struct {
+	docs []sortedDocument
+}
+
+func (r *memoryRun) next() (*sortedDocument, error) {
+	if len(r.docs) == 0 {
+		return nil, nil
+	}
+
+	doc := &r.docs[0]
+	r.docs = r.docs[1:]
+
+	return doc, nil
+}
+
+type fileRun struct {
+	reader *bufio.Reader
+}
+
+func (r *fileRun) next() (*sortedDocument, error) {
+	line, err := r.reader.ReadBytes('\n')
+	switch {
+	case errors.Is(err, io.EOF) && len(line) == 0:
+		return nil, nil
+	case err != nil && !errors.Is(err, io.EOF):
+		return nil, err
+	}
+
+	doc := &sortedDocument{}
+	if err := json.Unmarshal(line, doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// runHead is the next document of a run
+type runHead struct {
+	run documentRun
+	doc *sortedDocument
+}
+
+// runHeap orders the runs on their next document
+type runHeap []*runHead
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].doc.before(h[j].doc) }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runHead)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// sortedDocumentIterator merges the sorted runs of a documentSorter
+type sortedDocumentIterator struct {
+	runs runHeap
+}
+
+// next returns the document with the next id, nil once every document has been read
+func (it *sortedDocumentIterator) next() (*sortedDocument, error) {
+	if it.runs.Len() == 0 {
+		return nil, nil
+	}
+
+	doc, err := it.pop()
+	for err == nil && it.runs.Len() > 0 && it.runs[0].doc.ID == doc.ID {
+		doc, err = it.pop()
+	}
+
+	return doc, err
+}
+
+func (it *sortedDocumentIterator) pop() (*sortedDocument, error) {
+	head := it.runs[0]
+	doc := head.doc
+
+	next, err := head.run.next()
+	switch {
+	case err != nil:
+		return nil, err
+	case next == nil:
+		heap.Pop(&it.runs)
+	default:
+		head.doc = next
+		heap.Fix(&it.runs, 0)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,81 @@
+package console
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentSorter(t *testing.T) {
+	sortIDs := func(t *testing.T, batchSize int, docs ...map[string]any) []map[string]any {
+		sorter := newDocumentSorter(batchSize)
+		for _, doc := range docs {
+			require.NoError(t, sorter.add(doc["id"].(string), doc))
+		}
+
+		it, err := sorter.iterator()
+		require.NoError(t, err)
+
+		var sorted []map[string]any
+		for {
+			doc, err := it.next()
+			require.NoError(t, err)
+			if doc == nil {
+				break
+			}
+			sorted = append(sorted, doc.Doc)
+		}
+
+		runs := sorter.runs
+		require.NoError(t, sorter.Close())
+		for _, file := range runs {
+			assert.NoFileExists(t, file.Name())
+		}
+
+		return sorted
+	}
+
+	docs := []map[string]any{
+		{"id": "c", "n": 1.0},
+		{"id": "a", "n": 2.0},
+		{"id": "d", "n": 3.0},
+		{"id": "b", "n": 4.0},
+		{"id": "a", "n": 5.0},
+	}
+	expected := []map[string]any{
+		{"id": "a", "n": 5.0},
+		{"id": "b", "n": 4.0},
+		{"id": "c", "n": 1.0},
+		{"id": "d", "n": 3.0},
+	}
+
+	t.Run("sort in memory and keep the last document of an id", func(t *testing.T) {
+		assert.Equal(t, expected, sortIDs(t, 10, docs...))
+	})
+
+	t.Run("merge the run files and keep the last document of an id", func(t *testing.T) {
+		assert.Equal(t, expected, sortIDs(t, 2, docs...))
+	})
+
+	t.Run("sort nothing", func(t *testing.T) {
+		assert.Empty(t, sortIDs(t, 2))
+	})
+
+	t.Run("write the runs to the temporary folder", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("TMPDIR", dir)
+
+		sorter := newDocumentSorter(1)
+		require.NoError(t, sorter.add("a", map[string]any{"id": "a"}))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		require.NoError(t, sorter.Close())
+		entries, err = os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
@@ -0,0 +1,113 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocumentSource serves documents from memory, copies are handed out since the transforms modify them
+type fakeDocumentSource struct {
+	name string
+	docs []map[string]any
+}
+
+func (s *fakeDocumentSource) forEach(_ context.Context, fn func(doc map[string]any) error) error {
+	for _, doc := range s.docs {
+		if err := fn(maps.Clone(doc)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeDocumentSource) count(_ context.Context) (int64, error) {
+	return int64(len(s.docs)), nil
+}
+
+func (s *fakeDocumentSource) String() string {
+	return s.name
+}
+
+func TestVerifierRun(t *testing.T) {
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "transform.js")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(`
+function transform(doc) {
+	return doc.hidden ? null : doc;
+}
+`), 0o644))
+
+	source := &fakeDocumentSource{name: "articles", docs: []map[string]any{
+		{"id": "1", "title": "a"},
+		{"id": "2", "title": "b"},
+		{"id": "3", "title": "c", "views": 3.0},
+		{"id": "4", "title": "d", "hidden": true},
+		{"id": "5", "title": "e"},
+	}}
+	destination := &fakeDocumentSource{name: "articles_copy", docs: []map[string]any{
+		{"id": "1", "title": "a"},
+		{"id": "2", "title": "B"},
+		{"id": "3", "title": "c", "views": 3.0},
+		{"id": "99", "title": "z"},
+	}}
+
+	verify := func(t *testing.T, maxFieldDiffs, sortBatchSize int) (*verifier, []verifyReportEntry) {
+		transformer, err := newDocumentTransformer(nil, scriptPath)
+		require.NoError(t, err)
+
+		reportPath := filepath.Join(t.TempDir(), "verify_report.jsonl")
+		report, err := newVerifyReport(reportPath)
+		require.NoError(t, err)
+
+		v := &verifier{source: source, destination: destination, transformer: transformer, maxFieldDiffs: maxFieldDiffs, sortBatchSize: sortBatchSize, report: report}
+		require.NoError(t, v.run(context.Background()))
+		require.NoError(t, report.Close())
+
+		b, err := os.ReadFile(reportPath)
+		require.NoError(t, err)
+
+		var entries []verifyReportEntry
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			var entry verifyReportEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+
+		return v, entries
+	}
+
+	expectedEntries := []verifyReportEntry{
+		{ID: "2", Status: verifyStatusDifferent, Fields: map[string]fieldDiff{"title": {Expected: "b", Actual: "B"}}},
+		{ID: "5", Status: verifyStatusMissing},
+		{ID: "99", Status: verifyStatusExtra},
+	}
+
+	t.Run("report the extra, missing and different documents in id order", func(t *testing.T) {
+		v, entries := verify(t, 1000, 100)
+
+		assert.Equal(t, expectedEntries, entries)
+		assert.Equal(t, 2, v.matching)
+	})
+
+	t.Run("merge the sorted runs of collections larger than the sort batch", func(t *testing.T) {
+		v, entries := verify(t, 1000, 2)
+
+		assert.Equal(t, expectedEntries, entries)
+		assert.Equal(t, 2, v.matching)
+	})
+
+	t.Run("report the ids of the different documents only", func(t *testing.T) {
+		_, entries := verify(t, 0, 100)
+
+		assert.Contains(t, entries, verifyReportEntry{ID: "2", Status: verifyStatusDifferent})
+	})
+}